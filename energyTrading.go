@@ -6,50 +6,88 @@ import (
         "encoding/pem"
         "encoding/hex"
         "encoding/asn1"
+        "errors"
         "fmt"
         "crypto/sha256"
         "crypto/ecdsa"
         "crypto/x509"
+        "math"
         "math/big"
         "log"
+        "strings"
 
         "github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
 // Participant represents a trading participant with reputation, balance, and public key
+// Reputation is fixed-point in 0..maxReputation, representing 0.00-100.00 (see
+// reputationMigrated and migrateReputation for the transition from the old flat
+// 0-100 integer scheme).
 type Participant struct {
-        ID         string `json:"id"`
-        Reputation int    `json:"reputation"`
-        Balance    int    `json:"balance"`
-        PublicKey  string `json:"publicKey"`
+        ID                  string     `json:"id"`
+        Reputation          int        `json:"reputation"`
+        ReputationMigrated  bool       `json:"reputationMigrated"` // false on records written before the fixed-point EWMA scheme
+        RecentDefaultTimes  []int64    `json:"recentDefaultTimes"` // unix-second timestamps of this participant's recent at-fault defaults, for the slashing curve
+        Balance             int        `json:"balance"`
+        PublicKey           string     `json:"publicKey"`
+        MeterPublicKey      string     `json:"meterPublicKey"` // PEM-encoded ECDSA key a seller's smart meter signs delivery readings with; separate from PublicKey so the meter device need not hold the participant's trading key
+        TotalTradedVolume   int        `json:"totalTradedVolume"` // cumulative totalValue of SUCCESS-settled trades, used to scale dispute slashing
+        SignerSet           *SignerSet `json:"signerSet"`         // optional threshold multi-sig configuration for institutional participants
+        OutstandingLoanObligation int  `json:"outstandingLoanObligation"` // running total principal+interest owed across this participant's ACTIVE loans (see TakeLoan/RepayLoan/LiquidateLoan); kept current incrementally instead of re-scanning all loans on every balance check
+}
+
+// SignerSet lets an institutional participant authorize trades with M-of-N
+// signatures instead of a single key. PublicKeys is ordered; a SignerSig's
+// SignerIndex refers into this slice.
+type SignerSet struct {
+        Threshold  int      `json:"threshold"`
+        PublicKeys []string `json:"publicKeys"`
 }
 
 // Order represents a BUY or SELL order in the market
 type Order struct {
-        OrderID       string `json:"orderID"`
-        ParticipantID string `json:"participantID"`
-        OrderType     string `json:"orderType"`   // "BUY" or "SELL"
-        EnergyAmount  int    `json:"energyAmount"`// energy quantity for trade
-        Price         int    `json:"price"`       // price per unit energy
+        OrderID             string `json:"orderID"`
+        ParticipantID       string `json:"participantID"`
+        OrderType           string `json:"orderType"`   // "BUY" or "SELL"
+        EnergyAmount        int    `json:"energyAmount"`// energy quantity for trade
+        Price               int    `json:"price"`       // price per unit energy
+        BookKey             string `json:"bookKey"`     // composite ORDERBOOK_ key backing this order's book entry
+        MinReputationFloor  int    `json:"minReputationFloor"` // counterparty must meet this reputation, or the order refuses the trade
+        SettlementGracePeriod int  `json:"settlementGracePeriod"` // seconds this side allows, from token creation, to fulfil its obligation (0 = defaultSettlementGracePeriod)
 }
 
 // EnergyToken represents a transaction token (trade) with deposits and signatures
 type EnergyToken struct {
-        TokenID          string `json:"tokenID"`
-        BuyerID          string `json:"buyerID"`
-        SellerID         string `json:"sellerID"`
-        EnergyAmount     int    `json:"energyAmount"`
-        Price            int    `json:"price"`
-        Timestamp        int64  `json:"timestamp"`
-        State            string `json:"state"`            // "CREATED", "LOCKED", "SUCCESS", or "DEFAULT"
-        BuyerDeposit     int    `json:"buyerDeposit"`
-        SellerDeposit    int    `json:"sellerDeposit"`
-        BuyerReputation  int    `json:"buyerReputation"`
-        SellerReputation int    `json:"sellerReputation"`
-        BuyerSignature   string `json:"buyerSignature"`
-        SellerSignature  string `json:"sellerSignature"`
-        BuyerPaid        bool   `json:"buyerPaid"`        // whether buyer's payment confirmed
-        SellerDelivered  bool   `json:"sellerDelivered"`  // whether seller's energy delivery confirmed
+        TokenID          string         `json:"tokenID"`
+        BuyerID          string         `json:"buyerID"`
+        SellerID         string         `json:"sellerID"`
+        EnergyAmount     int            `json:"energyAmount"`
+        Price            int            `json:"price"`
+        Timestamp        int64          `json:"timestamp"`
+        State            string         `json:"state"`            // "CREATED", "LOCKED", "SUCCESS", or "DEFAULT"
+        BuyerDeposit     int            `json:"buyerDeposit"`
+        SellerDeposit    int            `json:"sellerDeposit"`
+        BuyerReputation  int            `json:"buyerReputation"`
+        SellerReputation int            `json:"sellerReputation"`
+        BuyerSignature   string         `json:"buyerSignature"`
+        SellerSignature  string         `json:"sellerSignature"`
+        BuyerPaid        bool           `json:"buyerPaid"`        // whether buyer's payment confirmed
+        SellerDelivered  bool           `json:"sellerDelivered"`  // whether DeliveredAmount has reached EnergyAmount
+        DeliveredAmount  float64        `json:"deliveredAmount"`  // cumulative kWh confirmed by MeterReadings so far
+        MeterReadings    []MeterReading `json:"meterReadings"`    // signed smart-meter samples backing DeliveredAmount, oldest first
+        DeliveryDeadline int64          `json:"deliveryDeadline"` // unix seconds; past this while LOCKED, seller is in default
+        PaymentDeadline  int64          `json:"paymentDeadline"`  // unix seconds; past this while LOCKED, buyer is in default
+}
+
+// MeterReading is a single signed smart-meter sample backing a token's
+// delivery reconciliation. CumulativeKWh is the meter's running total rather
+// than a delta, so consecutive readings for the same token must be
+// non-decreasing in both CumulativeKWh and Timestamp.
+type MeterReading struct {
+        Timestamp     int64   `json:"timestamp"`
+        CumulativeKWh float64 `json:"cumulativeKWh"`
+        MeterID       string  `json:"meterID"`
+        SignatureHex  string  `json:"signatureHex"`
 }
 
 // SmartContract provides functions for managing the RepuTrade chaincode
@@ -63,10 +101,122 @@ const orderPrefix = "ORDER_"
 const tokenPrefix = "TOKEN_"
 const orderCountKey = "ORDERCOUNT"
 const tokenCountKey = "TOKENCOUNT"
-const reputationThreshold = 20    // reputation threshold for order matching filter
-const maxReputation = 100         // maximum reputation score
+// Reputation is fixed-point in 0..maxReputation, representing 0.00-100.00.
+const reputationThreshold = 2000  // 20.00 — reputation threshold for order matching filter
+const maxReputation = 10000       // 100.00 — maximum reputation score
 const minDepositPercent = 5       // minimum deposit ratio (5%)
 const maxDepositPercent = 20      // maximum deposit ratio (20%)
+const defaultSettlementGracePeriod = 24 * 3600 // fallback grace period (seconds) when an order omits one
+
+// EWMA reputation update tuning. alphaScale fixed-points the [0.01, 0.25]
+// weighting factor so it can be computed with integer arithmetic.
+const alphaScale = 10000   // alphaScaled/alphaScale = the real-valued alpha
+const minAlphaScaled = 100  // 0.01
+const maxAlphaScaled = 2500 // 0.25
+const defaultAlphaScaled = 1250 // 0.125 — used to bootstrap before a rolling average trade size exists
+const reputationSlashBase = 500 // 5.00 — base reputation slash per at-fault default, before the recent-defaults multiplier
+const defaultsLookbackSeconds = 30 * 24 * 3600 // 30 days, for the slashing curve's defaults_last_30d count
+
+// Order book key family: ORDERBOOK_{BUY|SELL}_{priceKey}_{seq}
+// priceKey is a fixed-width, zero-padded, lexicographically-sortable encoding of
+// price (inverted for BUY so that ascending GetStateByRange scans yield descending
+// price), and seq is a monotonically-increasing per-price-level counter that breaks
+// ties by time priority (first to arrive at a price level sorts first).
+const orderBookPrefix = "ORDERBOOK_"
+const bookSeqPrefix = "BOOKSEQ_"
+const sideBuy = "BUY"
+const sideSell = "SELL"
+const priceKeyWidth = 19 // fits any non-negative int64 price in decimal
+const seqKeyWidth = 19
+
+// encodePriceKey renders price as a fixed-width, zero-padded decimal string so that
+// lexicographic ordering matches numeric ordering. BUY-side keys are inverted
+// (MaxInt64 - price) so that the best bid (highest price) sorts first when scanned
+// in ascending order, matching the best ask (lowest price) on the SELL side.
+func encodePriceKey(side string, price int) string {
+        if side == sideBuy {
+                return fmt.Sprintf("%0*d", priceKeyWidth, math.MaxInt64-int64(price))
+        }
+        return fmt.Sprintf("%0*d", priceKeyWidth, int64(price))
+}
+
+// bookSeqKey returns the state key tracking the next sequence number for a given
+// side/price level.
+func bookSeqKey(side string, price int) string {
+        return bookSeqPrefix + side + "_" + encodePriceKey(side, price)
+}
+
+// nextBookSeq allocates the next monotonically-increasing sequence number for the
+// given side/price level, used as the time-priority tiebreaker within that level.
+func nextBookSeq(ctx contractapi.TransactionContextInterface, side string, price int) (int64, error) {
+        key := bookSeqKey(side, price)
+        raw, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return 0, fmt.Errorf("failed to read book sequence counter: %v", err)
+        }
+        var seq int64
+        if raw != nil {
+                if err := json.Unmarshal(raw, &seq); err != nil {
+                        return 0, fmt.Errorf("failed to unmarshal book sequence counter: %v", err)
+                }
+        }
+        seq++
+        newRaw, err := json.Marshal(seq)
+        if err != nil {
+                return 0, fmt.Errorf("failed to marshal book sequence counter: %v", err)
+        }
+        if err := ctx.GetStub().PutState(key, newRaw); err != nil {
+                return 0, fmt.Errorf("failed to persist book sequence counter: %v", err)
+        }
+        return seq, nil
+}
+
+// bookEntryKey builds the composite book key for a resting order on the given side
+// at the given price and sequence number.
+func bookEntryKey(side string, price int, seq int64) string {
+        return fmt.Sprintf("%s%s_%s_%0*d", orderBookPrefix, side, encodePriceKey(side, price), seqKeyWidth, seq)
+}
+
+// OrderBookEntry is the value stored under a book key; it points back at the order
+// record so the matching engine can load full order details on demand.
+type OrderBookEntry struct {
+        OrderID string `json:"orderID"`
+}
+
+// OrderBookLevel summarizes the resting volume at a single price level, returned by
+// GetOrderBookDepth.
+type OrderBookLevel struct {
+        Price        int `json:"price"`
+        EnergyAmount int `json:"energyAmount"`
+}
+
+// putBookEntry writes the book entry for an order and records the resulting book
+// key on the order itself so it can be located again for removal.
+func putBookEntry(ctx contractapi.TransactionContextInterface, order *Order) error {
+        seq, err := nextBookSeq(ctx, order.OrderType, order.Price)
+        if err != nil {
+                return err
+        }
+        key := bookEntryKey(order.OrderType, order.Price, seq)
+        entry := OrderBookEntry{OrderID: order.OrderID}
+        entryJSON, err := json.Marshal(entry)
+        if err != nil {
+                return fmt.Errorf("failed to marshal book entry: %v", err)
+        }
+        if err := ctx.GetStub().PutState(key, entryJSON); err != nil {
+                return fmt.Errorf("failed to write book entry: %v", err)
+        }
+        order.BookKey = key
+        return nil
+}
+
+// removeBookEntry deletes the book entry backing an order, if any.
+func removeBookEntry(ctx contractapi.TransactionContextInterface, order Order) error {
+        if order.BookKey == "" {
+                return nil
+        }
+        return ctx.GetStub().DelState(order.BookKey)
+}
 
 // calculateDepositPercent computes deposit percentage based on reputation (higher rep -> lower deposit)
 func calculateDepositPercent(rep int) int {
@@ -77,16 +227,16 @@ func calculateDepositPercent(rep int) int {
                 rep = maxReputation
         }
         if rep < reputationThreshold {
-                // For rep below threshold (e.g., < 20), treat as threshold
+                // For rep below threshold, treat as threshold
                 rep = reputationThreshold
         }
-        // Linear interpolation: rep 20 -> 20%, rep 100 -> 5%
-        percent := 20 - (rep - 20) * 15 / 80
-        if percent < 5 {
-                percent = 5
+        // Linear interpolation: rep reputationThreshold -> maxDepositPercent, rep maxReputation -> minDepositPercent
+        percent := maxDepositPercent - (rep-reputationThreshold)*(maxDepositPercent-minDepositPercent)/(maxReputation-reputationThreshold)
+        if percent < minDepositPercent {
+                percent = minDepositPercent
         }
-        if percent > 20 {
-                percent = 20
+        if percent > maxDepositPercent {
+                percent = maxDepositPercent
         }
         return percent
 }
@@ -96,6 +246,195 @@ func participantKey(id string) string { return participantPrefix + id }
 func orderKey(id string) string       { return orderPrefix + id }
 func tokenKey(id string) string       { return tokenPrefix + id }
 
+// pairReputationKey addresses the directional trust rating accumulated between
+// one buyer and one seller, independent of either party's overall Reputation.
+func pairReputationKey(buyerID string, sellerID string) string {
+        return "pair~" + buyerID + "~" + sellerID
+}
+
+// migrateReputation rescales a Participant loaded from before the fixed-point
+// EWMA reputation scheme: such records hold a flat 0-100 integer, which this
+// maps onto the 0..maxReputation fixed-point range by multiplying by 100.
+// Idempotent via ReputationMigrated so a record is only ever rescaled once.
+func migrateReputation(p *Participant) {
+        if p.ReputationMigrated {
+                return
+        }
+        p.Reputation *= 100
+        if p.Reputation > maxReputation {
+                p.Reputation = maxReputation
+        }
+        if p.Reputation < 0 {
+                p.Reputation = 0
+        }
+        p.ReputationMigrated = true
+}
+
+// loadParticipant reads a Participant and migrates its Reputation onto the
+// fixed-point scale in place if it was written before that scheme existed,
+// persisting the migration so it only happens once. Callers that only need
+// Balance/PublicKey (not Reputation) may keep reading via plain GetState.
+func loadParticipant(ctx contractapi.TransactionContextInterface, id string) (*Participant, error) {
+        data, err := ctx.GetStub().GetState(participantKey(id))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read participant: %v", err)
+        }
+        if data == nil {
+                return nil, fmt.Errorf("participant %s does not exist", id)
+        }
+        var participant Participant
+        if err := json.Unmarshal(data, &participant); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal participant: %v", err)
+        }
+        if !participant.ReputationMigrated {
+                migrateReputation(&participant)
+                migratedBytes, err := json.Marshal(participant)
+                if err != nil {
+                        return nil, fmt.Errorf("failed to marshal migrated participant: %v", err)
+                }
+                if err := ctx.GetStub().PutState(participantKey(id), migratedBytes); err != nil {
+                        return nil, fmt.Errorf("failed to persist migrated participant: %v", err)
+                }
+        }
+        return &participant, nil
+}
+
+// TradeSizeStats tracks a rolling average settled-trade value (EnergyAmount *
+// Price), used to scale how much weight a single trade's outcome carries in
+// the reputation EWMA update: a trade much larger than the recent average
+// moves reputation further than a routine one.
+type TradeSizeStats struct {
+        RollingAvg int   `json:"rollingAvg"`
+        Count      int64 `json:"count"`
+}
+
+const avgTradeSizeKey = "AVGTRADESIZE"
+
+func loadTradeSizeStats(ctx contractapi.TransactionContextInterface) (*TradeSizeStats, error) {
+        data, err := ctx.GetStub().GetState(avgTradeSizeKey)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read trade size stats: %v", err)
+        }
+        if data == nil {
+                return &TradeSizeStats{}, nil
+        }
+        var stats TradeSizeStats
+        if err := json.Unmarshal(data, &stats); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal trade size stats: %v", err)
+        }
+        return &stats, nil
+}
+
+func saveTradeSizeStats(ctx contractapi.TransactionContextInterface, stats *TradeSizeStats) error {
+        data, err := json.Marshal(stats)
+        if err != nil {
+                return fmt.Errorf("failed to marshal trade size stats: %v", err)
+        }
+        return ctx.GetStub().PutState(avgTradeSizeKey, data)
+}
+
+// tradeAlpha derives a trade's EWMA blend weight from how its value compares
+// to the rolling average trade size recorded so far (falling back to
+// defaultAlphaScaled before any average exists), clamped to
+// [minAlphaScaled, maxAlphaScaled], then folds the trade into that rolling
+// average for future calls.
+func tradeAlpha(ctx contractapi.TransactionContextInterface, value int) (int, error) {
+        stats, err := loadTradeSizeStats(ctx)
+        if err != nil {
+                return 0, err
+        }
+        alphaScaled := defaultAlphaScaled
+        if stats.Count > 0 && stats.RollingAvg > 0 {
+                alphaScaled = (value * alphaScale) / stats.RollingAvg
+                if alphaScaled < minAlphaScaled {
+                        alphaScaled = minAlphaScaled
+                }
+                if alphaScaled > maxAlphaScaled {
+                        alphaScaled = maxAlphaScaled
+                }
+        }
+        if stats.Count == 0 {
+                stats.RollingAvg = value
+        } else {
+                stats.RollingAvg = (9*stats.RollingAvg + value) / 10
+        }
+        stats.Count++
+        if err := saveTradeSizeStats(ctx, stats); err != nil {
+                return 0, err
+        }
+        return alphaScaled, nil
+}
+
+// ewmaBlend applies one exponentially-weighted moving average step:
+// R_new = (alpha*outcome + (scale-alpha)*old) / scale, all in alphaScale
+// fixed-point terms.
+func ewmaBlend(old int, outcomeScaled int, alphaScaled int) int {
+        return (alphaScaled*outcomeScaled + (alphaScale-alphaScaled)*old) / alphaScale
+}
+
+// pruneRecentDefaults drops timestamps older than defaultsLookbackSeconds
+// from a chronologically-ordered slice of past default times.
+func pruneRecentDefaults(times []int64, now int64) []int64 {
+        cutoff := now - defaultsLookbackSeconds
+        pruned := times[:0]
+        for _, t := range times {
+                if t >= cutoff {
+                        pruned = append(pruned, t)
+                }
+        }
+        return pruned
+}
+
+// PairRating tracks a directional counterparty rating between two specific
+// participants (buyer, then seller), independent of either party's overall
+// Reputation, so a participant who trades well with one counterparty but
+// poorly with another isn't flattened into a single blended score.
+type PairRating struct {
+        Score int   `json:"score"`
+        Count int64 `json:"count"`
+}
+
+func loadPairRating(ctx contractapi.TransactionContextInterface, buyerID string, sellerID string) (*PairRating, error) {
+        data, err := ctx.GetStub().GetState(pairReputationKey(buyerID, sellerID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read pair rating: %v", err)
+        }
+        if data == nil {
+                return &PairRating{Score: maxReputation / 2}, nil
+        }
+        var rating PairRating
+        if err := json.Unmarshal(data, &rating); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal pair rating: %v", err)
+        }
+        return &rating, nil
+}
+
+func savePairRating(ctx contractapi.TransactionContextInterface, buyerID string, sellerID string, rating *PairRating) error {
+        data, err := json.Marshal(rating)
+        if err != nil {
+                return fmt.Errorf("failed to marshal pair rating: %v", err)
+        }
+        return ctx.GetStub().PutState(pairReputationKey(buyerID, sellerID), data)
+}
+
+// updatePairRating folds a trade's outcome into the buyer->seller directional
+// rating using the same EWMA blend weight as the individual reputation
+// update, so an unusually large trade moves the pair rating by the same
+// proportion it moves each party's overall reputation.
+func updatePairRating(ctx contractapi.TransactionContextInterface, buyerID string, sellerID string, alphaScaled int, success bool) error {
+        rating, err := loadPairRating(ctx, buyerID, sellerID)
+        if err != nil {
+                return err
+        }
+        outcome := 0
+        if success {
+                outcome = maxReputation
+        }
+        rating.Score = ewmaBlend(rating.Score, outcome, alphaScaled)
+        rating.Count++
+        return savePairRating(ctx, buyerID, sellerID, rating)
+}
+
 // ParticipantExists checks if a participant with given ID exists in the ledger
 func (s *SmartContract) ParticipantExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
         data, err := ctx.GetStub().GetState(participantKey(id))
@@ -139,6 +478,8 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 // CreateParticipant registers a new participant with given reputation, balance, and optionally a public key.
+// reputation is on the fixed-point 0-maxReputation scale (100 = 1.00 point); callers migrating from an
+// older 0-100 convention should multiply their value by 100 before calling this.
 // If pubKeyPem is empty, a new ECDSA key pair is generated for the participant.
 func (s *SmartContract) CreateParticipant(ctx contractapi.TransactionContextInterface, id string, reputation int, balance int, pubKeyPem string) error {
         exists, err := s.ParticipantExists(ctx, id)
@@ -171,10 +512,11 @@ func (s *SmartContract) CreateParticipant(ctx contractapi.TransactionContextInte
         }
 
         participant := Participant{
-                ID:         id,
-                Reputation: reputation,
-                Balance:    balance,
-                PublicKey:  pubKeyPem,
+                ID:                 id,
+                Reputation:         reputation,
+                ReputationMigrated: true,
+                Balance:            balance,
+                PublicKey:          pubKeyPem,
         }
 
         participantJSON, err := json.Marshal(participant)
@@ -186,7 +528,11 @@ func (s *SmartContract) CreateParticipant(ctx contractapi.TransactionContextInte
 }
 
 // CreateOrder places a new BUY or SELL order for a participant with specified energy amount and price.
-func (s *SmartContract) CreateOrder(ctx contractapi.TransactionContextInterface, id string, participantID string, energyAmount int, price int, orderType string) error {
+func (s *SmartContract) CreateOrder(ctx contractapi.TransactionContextInterface, id string, participantID string, energyAmount int, price int, orderType string, minReputationFloor int, settlementGracePeriod int) error {
+        if err := checkParticipantHalt(ctx, participantID); err != nil {
+                return err
+        }
+
         exists, err := s.OrderExists(ctx, id)
         if err != nil {
                 return fmt.Errorf("failed to check order existence: %v", err)
@@ -203,21 +549,20 @@ func (s *SmartContract) CreateOrder(ctx contractapi.TransactionContextInterface,
                 return fmt.Errorf("energy amount and price must be positive integers")
         }
 
-        participantJSON, err := ctx.GetStub().GetState(participantKey(participantID))
-        if err != nil {
-                return fmt.Errorf("failed to get participant: %v", err)
+        if minReputationFloor < 0 {
+                return fmt.Errorf("minimum reputation floor must not be negative")
         }
-        if participantJSON == nil {
-                return fmt.Errorf("participant %s does not exist", participantID)
+
+        if settlementGracePeriod < 0 {
+                return fmt.Errorf("settlement grace period must not be negative")
         }
 
-        var participant Participant
-        err = json.Unmarshal(participantJSON, &participant)
+        participant, err := loadParticipant(ctx, participantID)
         if err != nil {
-                return fmt.Errorf("failed to unmarshal participant: %v", err)
+                return err
         }
 
-        // 检查信誉值，最低允许为20
+        // 检查信誉值，最低允许为2000（定点数，对应20.00）
         if participant.Reputation < reputationThreshold {
                 return fmt.Errorf("participant reputation (%d) too low to create order (minimum required is %d)", participant.Reputation, reputationThreshold)
         }
@@ -226,16 +571,24 @@ func (s *SmartContract) CreateOrder(ctx contractapi.TransactionContextInterface,
         depPercent := calculateDepositPercent(participant.Reputation)
         minDeposit := (energyAmount * price * depPercent) / 100
 
-        if participant.Balance < minDeposit {
-                return fmt.Errorf("insufficient balance to create order, required deposit: %d, current balance: %d", minDeposit, participant.Balance)
+        // Outstanding loan principal+interest is not available to back a new order's deposit
+        available := availableBalance(*participant)
+        if available < minDeposit {
+                return fmt.Errorf("insufficient balance to create order, required deposit: %d, current available balance: %d", minDeposit, available)
         }
 
         order := Order{
-                OrderID:       id,
-                ParticipantID: participantID,
-                OrderType:     orderType,
-                EnergyAmount:  energyAmount,
-                Price:         price,
+                OrderID:               id,
+                ParticipantID:         participantID,
+                OrderType:             orderType,
+                EnergyAmount:          energyAmount,
+                Price:                 price,
+                MinReputationFloor:    minReputationFloor,
+                SettlementGracePeriod: settlementGracePeriod,
+        }
+
+        if err := putBookEntry(ctx, &order); err != nil {
+                return err
         }
 
         orderJSON, err := json.Marshal(order)
@@ -246,19 +599,50 @@ func (s *SmartContract) CreateOrder(ctx contractapi.TransactionContextInterface,
         return ctx.GetStub().PutState(orderKey(id), orderJSON)
 }
 
-// PerformMarketMatching executes the reputation-driven matching algorithm to match BUY and SELL orders.
-// It filters out orders from low-reputation participants, sorts remaining orders by price, 
-// and matches them iteratively. For each match, an EnergyToken is issued and relevant orders are updated or removed.
-func (sc *SmartContract) PerformMarketMatching(ctx contractapi.TransactionContextInterface) error {
-        // Retrieve all orders from state
+// SubmitOrder places a new order via CreateOrder and immediately attempts to cross
+// it against the opposite side of the book by invoking PerformMarketMatching. This
+// is what turns the resting order book into a continuous double auction: a marketable
+// order fills (fully or partially) in the same transaction it is submitted in, rather
+// than waiting for a separate matching call.
+func (s *SmartContract) SubmitOrder(ctx contractapi.TransactionContextInterface, id string, participantID string, energyAmount int, price int, orderType string, minReputationFloor int, settlementGracePeriod int) error {
+        if err := s.CreateOrder(ctx, id, participantID, energyAmount, price, orderType, minReputationFloor, settlementGracePeriod); err != nil {
+                return err
+        }
+        return s.PerformMarketMatching(ctx)
+}
+
+// CancelOrder withdraws a resting order from the book. It removes both the ORDER_
+// record and its ORDERBOOK_ entry so the order is no longer visible to matching.
+func (s *SmartContract) CancelOrder(ctx contractapi.TransactionContextInterface, id string) error {
+        orderJSON, err := ctx.GetStub().GetState(orderKey(id))
+        if err != nil {
+                return fmt.Errorf("failed to read order: %v", err)
+        }
+        if orderJSON == nil {
+                return fmt.Errorf("order %s does not exist", id)
+        }
+        var order Order
+        if err := json.Unmarshal(orderJSON, &order); err != nil {
+                return fmt.Errorf("failed to unmarshal order: %v", err)
+        }
+        if err := removeBookEntry(ctx, order); err != nil {
+                return fmt.Errorf("failed to remove book entry: %v", err)
+        }
+        return ctx.GetStub().DelState(orderKey(id))
+}
+
+// RebuildOrderBook is an idempotent migration that (re)constructs ORDERBOOK_ entries
+// from existing ORDER_ state. It is safe to run repeatedly and safe to run against a
+// ledger that already has some or all book entries populated: orders whose BookKey
+// already points at a live book entry are left untouched.
+func (s *SmartContract) RebuildOrderBook(ctx contractapi.TransactionContextInterface) error {
         iter, err := ctx.GetStub().GetStateByRange(orderPrefix, orderPrefix+"~")
         if err != nil {
                 return fmt.Errorf("failed to get orders: %v", err)
         }
         defer iter.Close()
 
-        var buyOrders []Order
-        var sellOrders []Order
+        var orders []Order
         for iter.HasNext() {
                 kv, err := iter.Next()
                 if err != nil {
@@ -268,103 +652,261 @@ func (sc *SmartContract) PerformMarketMatching(ctx contractapi.TransactionContex
                 if err := json.Unmarshal(kv.Value, &o); err != nil {
                         continue
                 }
-                // Filter out orders from participants with low reputation
-                partBytes, _ := ctx.GetStub().GetState(participantKey(o.ParticipantID))
-                if partBytes == nil {
+                orders = append(orders, o)
+        }
+
+        for _, order := range orders {
+                if order.BookKey != "" {
+                        existing, err := ctx.GetStub().GetState(order.BookKey)
+                        if err != nil {
+                                return fmt.Errorf("failed to check existing book entry: %v", err)
+                        }
+                        if existing != nil {
+                                // Already backed by a live book entry; nothing to do.
+                                continue
+                        }
+                }
+                if err := putBookEntry(ctx, &order); err != nil {
+                        return err
+                }
+                orderJSON, err := json.Marshal(order)
+                if err != nil {
+                        return fmt.Errorf("failed to marshal order: %v", err)
+                }
+                if err := ctx.GetStub().PutState(orderKey(order.OrderID), orderJSON); err != nil {
+                        return err
+                }
+        }
+        return nil
+}
+
+// GetOrderBookDepth returns up to `levels` resting price levels for the given side
+// ("BUY" or "SELL"), best price first, with the aggregate energy amount resting at
+// each level. It streams the book via GetStateByRange rather than loading the full
+// side into memory.
+func (s *SmartContract) GetOrderBookDepth(ctx contractapi.TransactionContextInterface, side string, levels int) ([]OrderBookLevel, error) {
+        if side != sideBuy && side != sideSell {
+                return nil, fmt.Errorf("side must be either BUY or SELL")
+        }
+        if levels <= 0 {
+                return nil, fmt.Errorf("levels must be a positive integer")
+        }
+
+        startKey := orderBookPrefix + side + "_"
+        endKey := orderBookPrefix + side + "_~"
+        iter, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+        if err != nil {
+                return nil, fmt.Errorf("failed to range over order book: %v", err)
+        }
+        defer iter.Close()
+
+        var depth []OrderBookLevel
+        for iter.HasNext() && len(depth) < levels {
+                kv, err := iter.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("error iterating order book: %v", err)
+                }
+                var entry OrderBookEntry
+                if err := json.Unmarshal(kv.Value, &entry); err != nil {
+                        continue
+                }
+                orderJSON, err := ctx.GetStub().GetState(orderKey(entry.OrderID))
+                if err != nil || orderJSON == nil {
+                        continue
+                }
+                var o Order
+                if err := json.Unmarshal(orderJSON, &o); err != nil {
+                        continue
+                }
+                if len(depth) > 0 && depth[len(depth)-1].Price == o.Price {
+                        depth[len(depth)-1].EnergyAmount += o.EnergyAmount
+                } else {
+                        depth = append(depth, OrderBookLevel{Price: o.Price, EnergyAmount: o.EnergyAmount})
+                }
+        }
+        return depth, nil
+}
+
+// bestOrder scans the order book for the given side, in price-time priority order.
+// Within the single best price level it is reputation-weighted: every order resting
+// at that price is considered, and the one belonging to the highest-reputation
+// participant is returned (ties broken by arrival order, i.e. the natural iteration
+// order of the book). Orders from participants that no longer clear the reputation
+// threshold are skipped. excluded, if non-nil, names order IDs to skip as well —
+// PerformMarketMatching uses this to route around a pairing it already rejected
+// (e.g. for an unmet reputation floor) without giving up on the rest of the book.
+// It never loads more than one price level into memory: the range iterator is
+// closed as soon as that level has been scanned in full.
+func bestOrder(ctx contractapi.TransactionContextInterface, side string, excluded map[string]bool) (*Order, error) {
+        startKey := orderBookPrefix + side + "_"
+        endKey := orderBookPrefix + side + "_~"
+        iter, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+        if err != nil {
+                return nil, fmt.Errorf("failed to range over %s book: %v", side, err)
+        }
+        defer iter.Close()
+
+        var bestPriceKey string
+        var best *Order
+        var bestReputation int
+
+        for iter.HasNext() {
+                kv, err := iter.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("error iterating %s book: %v", side, err)
+                }
+                priceKey := bookEntryPriceKey(kv.Key)
+                if bestPriceKey != "" && priceKey != bestPriceKey {
+                        // Moved past the best price level; remaining entries are worse priced.
+                        break
+                }
+
+                var entry OrderBookEntry
+                if err := json.Unmarshal(kv.Value, &entry); err != nil {
+                        continue
+                }
+                orderJSON, err := ctx.GetStub().GetState(orderKey(entry.OrderID))
+                if err != nil || orderJSON == nil {
+                        // Book entry outlived its order (shouldn't happen, but skip defensively)
+                        continue
+                }
+                var o Order
+                if err := json.Unmarshal(orderJSON, &o); err != nil {
+                        continue
+                }
+                if excluded[o.OrderID] {
+                        continue
+                }
+                p, err := loadParticipant(ctx, o.ParticipantID)
+                if err != nil {
                         continue
                 }
-                var p Participant
-                _ = json.Unmarshal(partBytes, &p)
                 if p.Reputation < reputationThreshold {
                         // skip orders from low-reputation participant (ignored for matching)
                         continue
                 }
-                if o.OrderType == "BUY" {
-                        buyOrders = append(buyOrders, o)
-                } else if o.OrderType == "SELL" {
-                        sellOrders = append(sellOrders, o)
+
+                bestPriceKey = priceKey
+                if best == nil || p.Reputation > bestReputation {
+                        o := o
+                        best = &o
+                        bestReputation = p.Reputation
                 }
         }
-        // Sort buy orders by descending price, sell orders by ascending price
-        for i := 0; i < len(buyOrders); i++ {
-                for j := i + 1; j < len(buyOrders); j++ {
-                        if buyOrders[j].Price > buyOrders[i].Price {
-                                buyOrders[i], buyOrders[j] = buyOrders[j], buyOrders[i]
-                        }
-                }
+        return best, nil
+}
+
+// bookEntryPriceKey extracts the side+price portion of an ORDERBOOK_ key, i.e.
+// everything up to (but not including) the trailing per-price-level sequence
+// component, so entries resting at the same price can be grouped while scanning.
+func bookEntryPriceKey(bookKey string) string {
+        idx := strings.LastIndex(bookKey, "_")
+        if idx < 0 {
+                return bookKey
+        }
+        return bookKey[:idx]
+}
+
+// PerformMarketMatching executes the reputation-driven matching algorithm to match BUY and SELL orders.
+// It repeatedly opens a best-bid and a best-ask range iterator over the persistent order book
+// (see ORDERBOOK_ keys) instead of loading and sorting every order in memory, so the cost of a
+// single invocation is proportional to the number of matches it produces rather than the size of
+// the book. For each match, an EnergyToken is issued and the underlying orders/book entries are
+// updated or removed by IssueToken. A pairing rejected for an unmet counterparty reputation floor
+// (see lockMatchedOrders) is excluded from future candidates and matching continues with the
+// next-best orders, rather than aborting the whole invocation — otherwise a single order with an
+// unmet floor sitting at the top of the book would permanently stall all matching on that side.
+func (sc *SmartContract) PerformMarketMatching(ctx contractapi.TransactionContextInterface) error {
+        if halt, err := activeHalt(ctx, scopeGlobal, ""); err != nil {
+                return err
+        } else if halt != nil {
+                return fmt.Errorf("market is halted (reason: %s)", halt.Reason)
         }
-        for i := 0; i < len(sellOrders); i++ {
-                for j := i + 1; j < len(sellOrders); j++ {
-                        if sellOrders[j].Price < sellOrders[i].Price {
-                                sellOrders[i], sellOrders[j] = sellOrders[j], sellOrders[i]
-                        }
+
+        excludedBuy := map[string]bool{}
+        excludedSell := map[string]bool{}
+        for {
+                buyOrder, err := bestOrder(ctx, sideBuy, excludedBuy)
+                if err != nil {
+                        return err
                 }
-        }
-        // Match orders iteratively
-        for len(buyOrders) > 0 && len(sellOrders) > 0 {
-                b := &buyOrders[0]
-                s := &sellOrders[0]
-                // Check if highest bid meets lowest ask
-                if b.Price >= s.Price {
-                        // Issue a transaction token for the matched pair (no signatures provided in automated matching)
-                        if err := sc.IssueToken(ctx, b.OrderID, s.OrderID, "", ""); err != nil {
-                                return err
-                        }
-                        // Determine if orders are fully or partially matched
-                        if b.EnergyAmount > s.EnergyAmount {
-                                // Buyer order partially fulfilled
-                                b.EnergyAmount -= s.EnergyAmount
-                                // Remove the seller order (fully fulfilled) from list
-                                sellOrders = sellOrders[1:]
-                                // Keep the buyer order in list with updated quantity
-                        } else if b.EnergyAmount < s.EnergyAmount {
-                                // Seller order partially fulfilled
-                                s.EnergyAmount -= b.EnergyAmount
-                                // Remove the buyer order (fully fulfilled) from list
-                                buyOrders = buyOrders[1:]
-                                // Keep the seller order in list with updated quantity
-                        } else {
-                                // Exact match, remove both orders from lists
-                                buyOrders = buyOrders[1:]
-                                sellOrders = sellOrders[1:]
-                        }
-                        continue
-                } else {
-                        // No matchable pairs if highest bid is below lowest ask
+                sellOrder, err := bestOrder(ctx, sideSell, excludedSell)
+                if err != nil {
+                        return err
+                }
+                if buyOrder == nil || sellOrder == nil {
+                        break
+                }
+                // No matchable pairs if the best bid is below the best ask
+                if buyOrder.Price < sellOrder.Price {
                         break
                 }
+                // Issue a transaction token for the matched pair (no signatures provided in automated matching)
+                if err := sc.IssueToken(ctx, buyOrder.OrderID, sellOrder.OrderID, "", ""); err != nil {
+                        var floorErr *reputationFloorError
+                        if errors.As(err, &floorErr) {
+                                excludedBuy[floorErr.buyOrderID] = true
+                                excludedSell[floorErr.sellOrderID] = true
+                                continue
+                        }
+                        return err
+                }
         }
         return nil
 }
 
-// IssueToken creates a new EnergyToken for a matched buy/sell order pair, locking deposits and recording a snapshot of reputations.
-// Optionally, it verifies provided digital signatures (buyerSigHex, sellerSigHex) using the participants' public keys.
-func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface, buyOrderID string, sellOrderID string, buyerSigHex string, sellerSigHex string) error {
+// reputationFloorError reports that a candidate buy/sell pair was rejected
+// because one side's counterparty reputation floor wasn't met. It carries
+// both order IDs so PerformMarketMatching can drop this specific pairing from
+// consideration and keep matching the rest of the book with the next-best
+// candidates, instead of treating the whole invocation as failed.
+type reputationFloorError struct {
+        buyOrderID  string
+        sellOrderID string
+        err         error
+}
+
+func (e *reputationFloorError) Error() string { return e.err.Error() }
+func (e *reputationFloorError) Unwrap() error { return e.err }
+
+// lockMatchedOrders validates a buy/sell order pair, computes the matched
+// quantity and trade price, locks reputation-scaled deposits out of both
+// participants' balances, and builds the (unsigned, unsaved) EnergyToken for
+// the match. It is the shared core behind IssueToken and IssueTokenMulti,
+// which differ only in how they verify and attach signatures.
+func (s *SmartContract) lockMatchedOrders(ctx contractapi.TransactionContextInterface, buyOrderID string, sellOrderID string) (*EnergyToken, Participant, Participant, Order, Order, error) {
+        var zeroBuyer, zeroSeller Participant
+        var zeroBuyOrder, zeroSellOrder Order
+
         // Fetch the buy and sell orders from state
         buyBytes, err := ctx.GetStub().GetState(orderKey(buyOrderID))
         if err != nil {
-                return fmt.Errorf("failed to read buy order: %v", err)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("failed to read buy order: %v", err)
         }
         sellBytes, err := ctx.GetStub().GetState(orderKey(sellOrderID))
         if err != nil {
-                return fmt.Errorf("failed to read sell order: %v", err)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("failed to read sell order: %v", err)
         }
         if buyBytes == nil || sellBytes == nil {
-                return fmt.Errorf("one or both order IDs not found or already matched")
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("one or both order IDs not found or already matched")
         }
         var buyOrder, sellOrder Order
         _ = json.Unmarshal(buyBytes, &buyOrder)
         _ = json.Unmarshal(sellBytes, &sellOrder)
         if buyOrder.OrderType != "BUY" || sellOrder.OrderType != "SELL" {
-                return fmt.Errorf("orders %s and %s are not complementary BUY/SELL", buyOrderID, sellOrderID)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("orders %s and %s are not complementary BUY/SELL", buyOrderID, sellOrderID)
         }
         // Ensure price condition is satisfied
         if buyOrder.Price < sellOrder.Price {
-                return fmt.Errorf("cannot issue token: buy order price (%d) is lower than sell order price (%d)", buyOrder.Price, sellOrder.Price)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("cannot issue token: buy order price (%d) is lower than sell order price (%d)", buyOrder.Price, sellOrder.Price)
         }
         // 防止自买自卖订单成交检查
         if buyOrder.ParticipantID == sellOrder.ParticipantID {
-                return fmt.Errorf("buyer and seller cannot be the same participant (%s)", buyOrder.ParticipantID)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("buyer and seller cannot be the same participant (%s)", buyOrder.ParticipantID)
+        }
+
+        if err := checkTradeHalt(ctx, buyOrder.ParticipantID, sellOrder.ParticipantID); err != nil {
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, err
         }
 
         // Determine matched quantity and trade price
@@ -372,50 +914,80 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
         if sellOrder.EnergyAmount < matchedQty {
                 matchedQty = sellOrder.EnergyAmount
         }
-        tradePrice := sellOrder.Price  // execute trade at seller's price
+        tradePrice := sellOrder.Price // execute trade at seller's price
         // Fetch participants (buyer and seller) from state
-        buyerBytes, err := ctx.GetStub().GetState(participantKey(buyOrder.ParticipantID))
+        buyerPtr, err := loadParticipant(ctx, buyOrder.ParticipantID)
         if err != nil {
-                return fmt.Errorf("failed to read buyer participant: %v", err)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("failed to read buyer participant: %v", err)
         }
-        sellerBytes, err := ctx.GetStub().GetState(participantKey(sellOrder.ParticipantID))
+        sellerPtr, err := loadParticipant(ctx, sellOrder.ParticipantID)
         if err != nil {
-                return fmt.Errorf("failed to read seller participant: %v", err)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, fmt.Errorf("failed to read seller participant: %v", err)
         }
-        if buyerBytes == nil || sellerBytes == nil {
-                return fmt.Errorf("buyer or seller participant not found")
+        buyer, seller := *buyerPtr, *sellerPtr
+        // Each side may demand a counterparty reputation floor; reject the match if unmet
+        if buyOrder.MinReputationFloor > 0 && seller.Reputation < buyOrder.MinReputationFloor {
+                err := fmt.Errorf("seller %s reputation (%d) does not meet buy order's minimum reputation floor (%d)", seller.ID, seller.Reputation, buyOrder.MinReputationFloor)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, &reputationFloorError{buyOrderID: buyOrderID, sellOrderID: sellOrderID, err: err}
         }
-        var buyer, seller Participant
-        _ = json.Unmarshal(buyerBytes, &buyer)
-        _ = json.Unmarshal(sellerBytes, &seller)
+        if sellOrder.MinReputationFloor > 0 && buyer.Reputation < sellOrder.MinReputationFloor {
+                err := fmt.Errorf("buyer %s reputation (%d) does not meet sell order's minimum reputation floor (%d)", buyer.ID, buyer.Reputation, sellOrder.MinReputationFloor)
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, &reputationFloorError{buyOrderID: buyOrderID, sellOrderID: sellOrderID, err: err}
+        }
+        deliveryGrace := sellOrder.SettlementGracePeriod
+        if deliveryGrace <= 0 {
+                deliveryGrace = defaultSettlementGracePeriod
+        }
+        paymentGrace := buyOrder.SettlementGracePeriod
+        if paymentGrace <= 0 {
+                paymentGrace = defaultSettlementGracePeriod
+        }
+        token, buyer, seller, err := mintLockedToken(ctx, buyer, seller, matchedQty, tradePrice, deliveryGrace, paymentGrace)
+        if err != nil {
+                return nil, zeroBuyer, zeroSeller, zeroBuyOrder, zeroSellOrder, err
+        }
+        return token, buyer, seller, buyOrder, sellOrder, nil
+}
+
+// mintLockedToken calculates reputation-scaled deposits for the matched buyer/seller
+// pair, locks them out of both balances, and builds (and persists the participant
+// side-effects of) a new LOCKED EnergyToken. It is the shared core behind
+// lockMatchedOrders' order-book path and SubmitSignedMatch's stateless path: both
+// already know who the counterparties are and what quantity/price they matched at,
+// they just arrive at that point via different order representations.
+func mintLockedToken(ctx contractapi.TransactionContextInterface, buyer Participant, seller Participant, matchedQty int, tradePrice int, deliveryGrace int, paymentGrace int) (*EnergyToken, Participant, Participant, error) {
+        var zeroBuyer, zeroSeller Participant
         // Calculate deposit amounts for buyer and seller based on their reputation and transaction value
         totalValue := matchedQty * tradePrice
         percentBuyer := calculateDepositPercent(buyer.Reputation)
         percentSeller := calculateDepositPercent(seller.Reputation)
         buyerDep := (percentBuyer * totalValue) / 100
         sellerDep := (percentSeller * totalValue) / 100
-        // Ensure participants have sufficient balance for deposits (and buyer for potential payment)
-        if buyer.Balance < buyerDep {
-                return fmt.Errorf("buyer %s has insufficient balance for deposit", buyer.ID)
+        // Ensure participants have sufficient balance for deposits,
+        // net of any principal+interest they still owe on outstanding loans
+        buyerAvailable := availableBalance(buyer)
+        sellerAvailable := availableBalance(seller)
+        if buyerAvailable < buyerDep {
+                return nil, zeroBuyer, zeroSeller, fmt.Errorf("buyer %s has insufficient balance for deposit", buyer.ID)
         }
-        if seller.Balance < sellerDep {
-                return fmt.Errorf("seller %s has insufficient balance for deposit", seller.ID)
+        if sellerAvailable < sellerDep {
+                return nil, zeroBuyer, zeroSeller, fmt.Errorf("seller %s has insufficient balance for deposit", seller.ID)
         }
         // (Optional) Check buyer's balance for full payment as well (liquidity check)
-        if buyer.Balance < buyerDep + totalValue {
+        if buyer.Balance < buyerDep+totalValue {
                 // Not enough balance for both deposit and full payment – proceed with deposit lock; actual payment checked at settlement
         }
         // Deduct deposit amounts from buyer and seller balances (lock in escrow)
         buyer.Balance -= buyerDep
         seller.Balance -= sellerDep
         // Update participant states with new balances
-        buyerBytes, _ = json.Marshal(buyer)
-        sellerBytes, _ = json.Marshal(seller)
-        if err := ctx.GetStub().PutState(participantKey(buyer.ID), buyerBytes); err != nil {
-                return err
+        buyerStateBytes, _ := json.Marshal(buyer)
+        sellerStateBytes, _ := json.Marshal(seller)
+        if err := ctx.GetStub().PutState(participantKey(buyer.ID), buyerStateBytes); err != nil {
+                return nil, zeroBuyer, zeroSeller, err
         }
-        if err := ctx.GetStub().PutState(participantKey(seller.ID), sellerBytes); err != nil {
-                return err
+        if err := ctx.GetStub().PutState(participantKey(seller.ID), sellerStateBytes); err != nil {
+                return nil, zeroBuyer, zeroSeller, err
         }
         // Generate a new TokenID
         countBytes, _ := ctx.GetStub().GetState(tokenCountKey)
@@ -430,10 +1002,16 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
         // Timestamp for token creation
         txTime, err := ctx.GetStub().GetTxTimestamp()
         if err != nil {
-                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+                return nil, zeroBuyer, zeroSeller, fmt.Errorf("failed to get transaction timestamp: %v", err)
         }
         // Convert protobuf Timestamp to Unix epoch seconds
         txTimeSeconds := txTime.GetSeconds()
+        if deliveryGrace <= 0 {
+                deliveryGrace = defaultSettlementGracePeriod
+        }
+        if paymentGrace <= 0 {
+                paymentGrace = defaultSettlementGracePeriod
+        }
         token := EnergyToken{
                 TokenID:          tokenID,
                 BuyerID:          buyer.ID,
@@ -450,22 +1028,89 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
                 SellerSignature:  "",
                 BuyerPaid:        false,
                 SellerDelivered:  false,
+                DeliveryDeadline: txTimeSeconds + int64(deliveryGrace),
+                PaymentDeadline:  txTimeSeconds + int64(paymentGrace),
         }
-        // Verify and record digital signatures if provided
-        if buyerSigHex != "" {
-                sigBytes, err := hex.DecodeString(buyerSigHex)
-                if err != nil {
-                        return fmt.Errorf("invalid buyer signature format: %v", err)
-                }
-                var sigStruct struct{ R, S *big.Int }
-                if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
-                        return fmt.Errorf("failed to parse buyer signature: %v", err)
-                }
-                block, _ := pem.Decode([]byte(buyer.PublicKey))
-                if block == nil {
-                        return fmt.Errorf("failed to decode buyer's public key PEM")
-                }
-                pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err := emitTokenEvent(ctx, "TokenLocked", &token); err != nil {
+                return nil, zeroBuyer, zeroSeller, err
+        }
+        return &token, buyer, seller, nil
+}
+
+// emitTokenEvent publishes a chaincode event carrying the full EnergyToken state,
+// so off-chain services can follow a token's lifecycle (e.g. to drive an
+// expiry-sweep loop) without polling the ledger.
+func emitTokenEvent(ctx contractapi.TransactionContextInterface, eventName string, token *EnergyToken) error {
+        tokenBytes, err := json.Marshal(token)
+        if err != nil {
+                return fmt.Errorf("failed to marshal token %s for event %s: %v", token.TokenID, eventName, err)
+        }
+        return ctx.GetStub().SetEvent(eventName, tokenBytes)
+}
+
+// finalizeMatchedOrders updates or removes the matched orders after a token
+// has been issued. A fully-fulfilled order's ORDER_ record and ORDERBOOK_
+// entry are both deleted; a partially-fulfilled order keeps its book entry
+// (its price/priority is unchanged) and only its ORDER_ record is updated
+// with the remaining quantity.
+func finalizeMatchedOrders(ctx contractapi.TransactionContextInterface, buyOrder Order, sellOrder Order) error {
+        if buyOrder.EnergyAmount > sellOrder.EnergyAmount {
+                // Buyer order partially fulfilled: reduce its amount and update state
+                buyOrder.EnergyAmount -= sellOrder.EnergyAmount
+                updatedBuyBytes, _ := json.Marshal(buyOrder)
+                ctx.GetStub().PutState(orderKey(buyOrder.OrderID), updatedBuyBytes)
+                // Seller order fully fulfilled: remove it and its book entry from state
+                ctx.GetStub().DelState(orderKey(sellOrder.OrderID))
+                if err := removeBookEntry(ctx, sellOrder); err != nil {
+                        return fmt.Errorf("failed to remove seller book entry: %v", err)
+                }
+        } else if buyOrder.EnergyAmount < sellOrder.EnergyAmount {
+                // Seller order partially fulfilled: reduce its amount and update state
+                sellOrder.EnergyAmount -= buyOrder.EnergyAmount
+                updatedSellBytes, _ := json.Marshal(sellOrder)
+                ctx.GetStub().PutState(orderKey(sellOrder.OrderID), updatedSellBytes)
+                // Buyer order fully fulfilled: remove it and its book entry from state
+                ctx.GetStub().DelState(orderKey(buyOrder.OrderID))
+                if err := removeBookEntry(ctx, buyOrder); err != nil {
+                        return fmt.Errorf("failed to remove buyer book entry: %v", err)
+                }
+        } else {
+                // Both orders fully matched: remove both orders and their book entries from state
+                ctx.GetStub().DelState(orderKey(buyOrder.OrderID))
+                ctx.GetStub().DelState(orderKey(sellOrder.OrderID))
+                if err := removeBookEntry(ctx, buyOrder); err != nil {
+                        return fmt.Errorf("failed to remove buyer book entry: %v", err)
+                }
+                if err := removeBookEntry(ctx, sellOrder); err != nil {
+                        return fmt.Errorf("failed to remove seller book entry: %v", err)
+                }
+        }
+        return nil
+}
+
+// IssueToken creates a new EnergyToken for a matched buy/sell order pair, locking deposits and recording a snapshot of reputations.
+// Optionally, it verifies provided digital signatures (buyerSigHex, sellerSigHex) using the participants' public keys.
+func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface, buyOrderID string, sellOrderID string, buyerSigHex string, sellerSigHex string) error {
+        token, buyer, seller, buyOrder, sellOrder, err := s.lockMatchedOrders(ctx, buyOrderID, sellOrderID)
+        if err != nil {
+                return err
+        }
+
+        // Verify and record digital signatures if provided
+        if buyerSigHex != "" {
+                sigBytes, err := hex.DecodeString(buyerSigHex)
+                if err != nil {
+                        return fmt.Errorf("invalid buyer signature format: %v", err)
+                }
+                var sigStruct struct{ R, S *big.Int }
+                if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
+                        return fmt.Errorf("failed to parse buyer signature: %v", err)
+                }
+                block, _ := pem.Decode([]byte(buyer.PublicKey))
+                if block == nil {
+                        return fmt.Errorf("failed to decode buyer's public key PEM")
+                }
+                pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
                 if err != nil {
                         return fmt.Errorf("failed to parse buyer's public key: %v", err)
                 }
@@ -474,7 +1119,7 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
                         return fmt.Errorf("buyer public key is not ECDSA")
                 }
                 // Use tokenID as the message to verify signature
-                msgHash := sha256.Sum256([]byte(tokenID))
+                msgHash := sha256.Sum256([]byte(token.TokenID))
                 if !ecdsa.Verify(pubKey, msgHash[:], sigStruct.R, sigStruct.S) {
                         return fmt.Errorf("buyer signature verification failed")
                 }
@@ -501,7 +1146,7 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
                 if !ok {
                         return fmt.Errorf("seller public key is not ECDSA")
                 }
-                msgHash := sha256.Sum256([]byte(tokenID))
+                msgHash := sha256.Sum256([]byte(token.TokenID))
                 if !ecdsa.Verify(pubKey, msgHash[:], sigStruct.R, sigStruct.S) {
                         return fmt.Errorf("seller signature verification failed")
                 }
@@ -509,35 +1154,390 @@ func (s *SmartContract) IssueToken(ctx contractapi.TransactionContextInterface,
         }
         // Store the new EnergyToken on the ledger
         tokenBytes, _ := json.Marshal(token)
-        if err := ctx.GetStub().PutState(tokenKey(tokenID), tokenBytes); err != nil {
+        if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
                 return err
         }
-        // Update or remove the matched orders due to this trade
-        if buyOrder.EnergyAmount > sellOrder.EnergyAmount {
-                // Buyer order partially fulfilled: reduce its amount and update state
-                buyOrder.EnergyAmount -= sellOrder.EnergyAmount
-                updatedBuyBytes, _ := json.Marshal(buyOrder)
-                ctx.GetStub().PutState(orderKey(buyOrder.OrderID), updatedBuyBytes)
-                // Seller order fully fulfilled: remove it from state
-                ctx.GetStub().DelState(orderKey(sellOrder.OrderID))
-        } else if buyOrder.EnergyAmount < sellOrder.EnergyAmount {
-                // Seller order partially fulfilled: reduce its amount and update state
-                sellOrder.EnergyAmount -= buyOrder.EnergyAmount
-                updatedSellBytes, _ := json.Marshal(sellOrder)
-                ctx.GetStub().PutState(orderKey(sellOrder.OrderID), updatedSellBytes)
-                // Buyer order fully fulfilled: remove it from state
-                ctx.GetStub().DelState(orderKey(buyOrder.OrderID))
-        } else {
-                // Both orders fully matched: remove both from state
-                ctx.GetStub().DelState(orderKey(buyOrder.OrderID))
-                ctx.GetStub().DelState(orderKey(sellOrder.OrderID))
+        return finalizeMatchedOrders(ctx, buyOrder, sellOrder)
+}
+
+// SignerSig is one signature contributed toward a threshold signature blob:
+// SignerIndex identifies which key in the participant's SignerSet.PublicKeys
+// produced SigHex.
+type SignerSig struct {
+        SignerIndex int    `json:"signerIndex"`
+        SigHex      string `json:"sigHex"`
+}
+
+// SetSignerSet configures (or replaces) a participant's threshold multi-sig
+// policy, used by IssueTokenMulti and BatchIssueTokens in place of the
+// participant's single PublicKey.
+func (s *SmartContract) SetSignerSet(ctx contractapi.TransactionContextInterface, participantID string, threshold int, publicKeysPem []string) error {
+        partBytes, err := ctx.GetStub().GetState(participantKey(participantID))
+        if err != nil {
+                return fmt.Errorf("failed to read participant: %v", err)
+        }
+        if partBytes == nil {
+                return fmt.Errorf("participant %s does not exist", participantID)
+        }
+        var participant Participant
+        if err := json.Unmarshal(partBytes, &participant); err != nil {
+                return fmt.Errorf("failed to unmarshal participant: %v", err)
+        }
+        if threshold <= 0 || threshold > len(publicKeysPem) {
+                return fmt.Errorf("threshold must be between 1 and the number of public keys (%d)", len(publicKeysPem))
+        }
+        for i, keyPem := range publicKeysPem {
+                block, _ := pem.Decode([]byte(keyPem))
+                if block == nil || block.Type != "PUBLIC KEY" {
+                        return fmt.Errorf("invalid PEM format for public key at index %d", i)
+                }
+                pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+                if err != nil {
+                        return fmt.Errorf("invalid public key data at index %d: %v", i, err)
+                }
+                if _, ok := pubInterface.(*ecdsa.PublicKey); !ok {
+                        return fmt.Errorf("public key at index %d is not ECDSA format", i)
+                }
+        }
+
+        participant.SignerSet = &SignerSet{Threshold: threshold, PublicKeys: publicKeysPem}
+        updatedBytes, err := json.Marshal(participant)
+        if err != nil {
+                return fmt.Errorf("failed to marshal participant: %v", err)
+        }
+        return ctx.GetStub().PutState(participantKey(participantID), updatedBytes)
+}
+
+// parseECDSAPublicKeyPEM decodes a PEM-encoded PKIX ECDSA public key.
+func parseECDSAPublicKeyPEM(keyPem string) (*ecdsa.PublicKey, error) {
+        block, _ := pem.Decode([]byte(keyPem))
+        if block == nil {
+                return nil, fmt.Errorf("failed to decode public key PEM")
+        }
+        pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+                return nil, fmt.Errorf("failed to parse public key: %v", err)
+        }
+        pubKey, ok := pubInterface.(*ecdsa.PublicKey)
+        if !ok {
+                return nil, fmt.Errorf("public key is not ECDSA")
+        }
+        return pubKey, nil
+}
+
+// verifyThresholdSignaturesCached checks that sigsJSON (a JSON array of
+// SignerSig) contains at least participant.SignerSet.Threshold valid
+// signatures over msgHash, each from a distinct index into
+// SignerSet.PublicKeys. keyCache memoizes parsed *ecdsa.PublicKey objects by
+// PEM string so callers verifying many participants' signatures (e.g.
+// BatchIssueTokens) only pay the PEM/PKIX parse cost once per distinct key.
+func verifyThresholdSignaturesCached(participant Participant, msgHash [32]byte, sigsJSON string, keyCache map[string]*ecdsa.PublicKey) error {
+        if participant.SignerSet == nil {
+                return fmt.Errorf("participant %s has no signer set configured", participant.ID)
+        }
+        var sigs []SignerSig
+        if err := json.Unmarshal([]byte(sigsJSON), &sigs); err != nil {
+                return fmt.Errorf("failed to unmarshal signatures: %v", err)
+        }
+
+        validIndices := make(map[int]bool)
+        for _, sig := range sigs {
+                if sig.SignerIndex < 0 || sig.SignerIndex >= len(participant.SignerSet.PublicKeys) {
+                        continue
+                }
+                if validIndices[sig.SignerIndex] {
+                        continue
+                }
+                keyPem := participant.SignerSet.PublicKeys[sig.SignerIndex]
+                pubKey, cached := keyCache[keyPem]
+                if !cached {
+                        parsedKey, err := parseECDSAPublicKeyPEM(keyPem)
+                        if err != nil {
+                                continue
+                        }
+                        keyCache[keyPem] = parsedKey
+                        pubKey = parsedKey
+                }
+                sigBytes, err := hex.DecodeString(sig.SigHex)
+                if err != nil {
+                        continue
+                }
+                var sigStruct struct{ R, S *big.Int }
+                if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
+                        continue
+                }
+                if ecdsa.Verify(pubKey, msgHash[:], sigStruct.R, sigStruct.S) {
+                        validIndices[sig.SignerIndex] = true
+                }
+        }
+        if len(validIndices) < participant.SignerSet.Threshold {
+                return fmt.Errorf("only %d of required %d distinct valid signatures for participant %s", len(validIndices), participant.SignerSet.Threshold, participant.ID)
+        }
+        return nil
+}
+
+// IssueTokenMulti is the threshold-multi-sig counterpart to IssueToken, for
+// institutional participants configured with a SignerSet (see SetSignerSet).
+// Each side's signatures blob is a JSON array of SignerSig; verification
+// succeeds once at least that side's Threshold distinct signers have
+// produced a valid signature over sha256(tokenID || nonce). nonce is
+// caller-supplied so off-chain co-signers can agree on the exact message to
+// sign before the token (and therefore its ID) exists on the ledger.
+func (s *SmartContract) IssueTokenMulti(ctx contractapi.TransactionContextInterface, buyOrderID string, sellOrderID string, nonce string, buyerSigsJSON string, sellerSigsJSON string) error {
+        token, buyer, seller, buyOrder, sellOrder, err := s.lockMatchedOrders(ctx, buyOrderID, sellOrderID)
+        if err != nil {
+                return err
+        }
+
+        keyCache := make(map[string]*ecdsa.PublicKey)
+        msgHash := sha256.Sum256([]byte(token.TokenID + nonce))
+        if err := verifyThresholdSignaturesCached(buyer, msgHash, buyerSigsJSON, keyCache); err != nil {
+                return fmt.Errorf("buyer signature verification failed: %v", err)
+        }
+        if err := verifyThresholdSignaturesCached(seller, msgHash, sellerSigsJSON, keyCache); err != nil {
+                return fmt.Errorf("seller signature verification failed: %v", err)
+        }
+        token.BuyerSignature = buyerSigsJSON
+        token.SellerSignature = sellerSigsJSON
+
+        tokenBytes, _ := json.Marshal(token)
+        if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
+                return err
+        }
+        return finalizeMatchedOrders(ctx, buyOrder, sellOrder)
+}
+
+// MatchPair identifies one buy/sell order pair for BatchIssueTokens.
+type MatchPair struct {
+        BuyOrderID  string `json:"buyOrderID"`
+        SellOrderID string `json:"sellOrderID"`
+        Nonce       string `json:"nonce"`
+}
+
+// BatchSigs carries the threshold signature blobs for one MatchPair, indexed
+// by position within the BatchIssueTokens pairs slice.
+type BatchSigs struct {
+        BuyerSigsJSON  string `json:"buyerSigsJSON"`
+        SellerSigsJSON string `json:"sellerSigsJSON"`
+}
+
+// BatchIssueTokens verifies and issues tokens for many MatchPairs in a single
+// invocation. It pre-hashes every pair's message and caches parsed
+// *ecdsa.PublicKey objects across pairs (deduplicated by PEM string), so a
+// relayer settling many institutional trades pays the PEM/PKIX parse cost
+// once per distinct key rather than once per pair.
+func (s *SmartContract) BatchIssueTokens(ctx contractapi.TransactionContextInterface, pairs []MatchPair, sigs []BatchSigs) error {
+        if len(pairs) != len(sigs) {
+                return fmt.Errorf("pairs and sigs must be the same length (got %d and %d)", len(pairs), len(sigs))
+        }
+
+        keyCache := make(map[string]*ecdsa.PublicKey)
+
+        for i, pair := range pairs {
+                token, buyer, seller, buyOrder, sellOrder, err := s.lockMatchedOrders(ctx, pair.BuyOrderID, pair.SellOrderID)
+                if err != nil {
+                        return fmt.Errorf("pair %d: %v", i, err)
+                }
+                msgHash := sha256.Sum256([]byte(token.TokenID + pair.Nonce))
+                if err := verifyThresholdSignaturesCached(buyer, msgHash, sigs[i].BuyerSigsJSON, keyCache); err != nil {
+                        return fmt.Errorf("pair %d buyer signature verification failed: %v", i, err)
+                }
+                if err := verifyThresholdSignaturesCached(seller, msgHash, sigs[i].SellerSigsJSON, keyCache); err != nil {
+                        return fmt.Errorf("pair %d seller signature verification failed: %v", i, err)
+                }
+                token.BuyerSignature = sigs[i].BuyerSigsJSON
+                token.SellerSignature = sigs[i].SellerSigsJSON
+
+                tokenBytes, _ := json.Marshal(token)
+                if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
+                        return fmt.Errorf("pair %d: %v", i, err)
+                }
+                if err := finalizeMatchedOrders(ctx, buyOrder, sellOrder); err != nil {
+                        return fmt.Errorf("pair %d: %v", i, err)
+                }
+        }
+        return nil
+}
+
+// ---------------------------------------------------------------------------
+// Stateless off-chain signed orders
+//
+// A SignedOrder never touches the ledger on its own: participants build the
+// canonical JSON encoding below, sign its raw bytes off-chain with their
+// ECDSA key (the same key registered via CreateParticipant), and pass the
+// encoded order and signature straight into SubmitSignedMatch. This avoids
+// the per-order PutState that CreateOrder/PerformMarketMatching pay, at the
+// cost of requiring a matched buy/sell pair to be assembled off-chain first
+// (by a relayer or the counterparties themselves).
+
+// SignedOrder is the canonical, off-chain-signed encoding of one side of a
+// match. The participant signs exactly the JSON bytes they send in, so the
+// message passed to VerifySignature is that raw string, not a re-encoding of
+// this struct (whitespace/field-order differences would otherwise break
+// verification).
+type SignedOrder struct {
+        ParticipantID string `json:"participantID"`
+        OrderType     string `json:"orderType"` // "BUY" or "SELL"
+        EnergyAmount  int    `json:"energyAmount"`
+        Price         int    `json:"price"`
+        WindowStart   int64  `json:"windowStart"` // delivery window start, unix seconds
+        WindowEnd     int64  `json:"windowEnd"`   // delivery window end, unix seconds
+        Nonce         uint64 `json:"nonce"`       // must exceed this participant's last-used nonce
+        Expiry        int64  `json:"expiry"`      // unix seconds; order is void once GetTxTimestamp passes this
+}
+
+const noncePrefix = "NONCE_"
+
+func nonceKey(participantID string) string { return noncePrefix + participantID }
+
+// checkAndAdvanceNonce enforces that nonce is strictly greater than the
+// participant's last accepted nonce (replay protection for stateless signed
+// orders, which have no Order record a repeat submission could collide
+// against), then records it as the new high-water mark.
+func checkAndAdvanceNonce(ctx contractapi.TransactionContextInterface, participantID string, nonce uint64) error {
+        lastBytes, err := ctx.GetStub().GetState(nonceKey(participantID))
+        if err != nil {
+                return fmt.Errorf("failed to read nonce for %s: %v", participantID, err)
+        }
+        var last uint64
+        if lastBytes != nil {
+                if err := json.Unmarshal(lastBytes, &last); err != nil {
+                        return fmt.Errorf("failed to unmarshal nonce for %s: %v", participantID, err)
+                }
+        }
+        if nonce <= last {
+                return fmt.Errorf("nonce %d for %s has already been used (last used: %d)", nonce, participantID, last)
+        }
+        newBytes, _ := json.Marshal(nonce)
+        return ctx.GetStub().PutState(nonceKey(participantID), newBytes)
+}
+
+// verifyAndMintSignedMatch validates one buy/sell pair of SignedOrders (complementary
+// sides, matching price, distinct participants, valid signatures, unexpired, fresh
+// nonces, no active halt, sufficient reputation) and mints a single LOCKED
+// EnergyToken for the matched quantity. It is the shared core behind
+// SubmitSignedMatch and SubmitSignedMatchBatch.
+func (s *SmartContract) verifyAndMintSignedMatch(ctx contractapi.TransactionContextInterface, buyOrderJSON string, buySig string, sellOrderJSON string, sellSig string) (*EnergyToken, error) {
+        var buyOrder, sellOrder SignedOrder
+        if err := json.Unmarshal([]byte(buyOrderJSON), &buyOrder); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal buy order: %v", err)
+        }
+        if err := json.Unmarshal([]byte(sellOrderJSON), &sellOrder); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal sell order: %v", err)
+        }
+        if buyOrder.OrderType != "BUY" || sellOrder.OrderType != "SELL" {
+                return nil, fmt.Errorf("signed orders are not a complementary BUY/SELL pair")
+        }
+        if buyOrder.EnergyAmount <= 0 || sellOrder.EnergyAmount <= 0 || buyOrder.Price <= 0 || sellOrder.Price <= 0 {
+                return nil, fmt.Errorf("energy amount and price must be positive integers")
+        }
+        if buyOrder.Price < sellOrder.Price {
+                return nil, fmt.Errorf("cannot match: buy order price (%d) is lower than sell order price (%d)", buyOrder.Price, sellOrder.Price)
+        }
+        if buyOrder.ParticipantID == sellOrder.ParticipantID {
+                return nil, fmt.Errorf("buyer and seller cannot be the same participant (%s)", buyOrder.ParticipantID)
+        }
+
+        buyValid, err := s.VerifySignature(ctx, buyOrder.ParticipantID, buyOrderJSON, buySig)
+        if err != nil {
+                return nil, fmt.Errorf("buy order signature verification failed: %v", err)
+        }
+        if !buyValid {
+                return nil, fmt.Errorf("buy order signature is invalid for participant %s", buyOrder.ParticipantID)
+        }
+        sellValid, err := s.VerifySignature(ctx, sellOrder.ParticipantID, sellOrderJSON, sellSig)
+        if err != nil {
+                return nil, fmt.Errorf("sell order signature verification failed: %v", err)
+        }
+        if !sellValid {
+                return nil, fmt.Errorf("sell order signature is invalid for participant %s", sellOrder.ParticipantID)
+        }
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        now := txTime.GetSeconds()
+        if now > buyOrder.Expiry {
+                return nil, fmt.Errorf("buy order from %s has expired", buyOrder.ParticipantID)
+        }
+        if now > sellOrder.Expiry {
+                return nil, fmt.Errorf("sell order from %s has expired", sellOrder.ParticipantID)
+        }
+
+        if err := checkAndAdvanceNonce(ctx, buyOrder.ParticipantID, buyOrder.Nonce); err != nil {
+                return nil, fmt.Errorf("buy order nonce rejected: %v", err)
+        }
+        if err := checkAndAdvanceNonce(ctx, sellOrder.ParticipantID, sellOrder.Nonce); err != nil {
+                return nil, fmt.Errorf("sell order nonce rejected: %v", err)
+        }
+
+        if err := checkTradeHalt(ctx, buyOrder.ParticipantID, sellOrder.ParticipantID); err != nil {
+                return nil, err
+        }
+
+        buyerPtr, err := loadParticipant(ctx, buyOrder.ParticipantID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read buyer participant: %v", err)
+        }
+        sellerPtr, err := loadParticipant(ctx, sellOrder.ParticipantID)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read seller participant: %v", err)
+        }
+        buyer, seller := *buyerPtr, *sellerPtr
+        if buyer.Reputation < reputationThreshold || seller.Reputation < reputationThreshold {
+                return nil, fmt.Errorf("participant reputation too low to settle a signed match (minimum required is %d)", reputationThreshold)
+        }
+
+        matchedQty := buyOrder.EnergyAmount
+        if sellOrder.EnergyAmount < matchedQty {
+                matchedQty = sellOrder.EnergyAmount
+        }
+        tradePrice := sellOrder.Price
+
+        token, _, _, err := mintLockedToken(ctx, buyer, seller, matchedQty, tradePrice, 0, 0)
+        if err != nil {
+                return nil, err
+        }
+        tokenBytes, err := json.Marshal(token)
+        if err != nil {
+                return nil, fmt.Errorf("failed to marshal token: %v", err)
+        }
+        if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
+                return nil, err
+        }
+        return token, nil
+}
+
+// SubmitSignedMatch settles a single off-chain agreed buy/sell pair: it verifies
+// both parties' signatures over their own canonical SignedOrder JSON, checks
+// nonce and expiry, and mints a LOCKED EnergyToken directly. No Order record is
+// ever written to state.
+func (s *SmartContract) SubmitSignedMatch(ctx contractapi.TransactionContextInterface, buyOrderJSON string, buySig string, sellOrderJSON string, sellSig string) error {
+        _, err := s.verifyAndMintSignedMatch(ctx, buyOrderJSON, buySig, sellOrderJSON, sellSig)
+        return err
+}
+
+// SubmitSignedMatchBatch settles many signed matches in a single invocation, so a
+// relayer can amortize endorsement/ordering cost across a batch of off-chain
+// agreed trades. As with BatchIssueTokens, the batch is atomic: a single pair's
+// failure fails the whole transaction proposal, so nothing in the batch commits
+// partially.
+func (s *SmartContract) SubmitSignedMatchBatch(ctx contractapi.TransactionContextInterface, buyOrderJSONs []string, buySigs []string, sellOrderJSONs []string, sellSigs []string) error {
+        if len(buyOrderJSONs) != len(buySigs) || len(buyOrderJSONs) != len(sellOrderJSONs) || len(buyOrderJSONs) != len(sellSigs) {
+                return fmt.Errorf("signed match arrays must all be the same length")
+        }
+        for i := range buyOrderJSONs {
+                if _, err := s.verifyAndMintSignedMatch(ctx, buyOrderJSONs[i], buySigs[i], sellOrderJSONs[i], sellSigs[i]); err != nil {
+                        return fmt.Errorf("match %d: %v", i, err)
+                }
         }
         return nil
 }
 
 // ProcessEnergyFlow simulates the confirmation of energy delivery for a given transaction (token).
 // It marks the token as energy delivered by the seller.
-func (s *SmartContract) ProcessEnergyFlow(ctx contractapi.TransactionContextInterface, tokenID string) error {
+func (s *SmartContract) ProcessEnergyFlow(ctx contractapi.TransactionContextInterface, tokenID string, readingJSON string, signatureHex string) error {
         tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
         if err != nil {
                 return fmt.Errorf("failed to read token: %v", err)
@@ -546,16 +1546,75 @@ func (s *SmartContract) ProcessEnergyFlow(ctx contractapi.TransactionContextInte
                 return fmt.Errorf("transaction token %s not found", tokenID)
         }
         var token EnergyToken
-        _ = json.Unmarshal(tokenBytes, &token)
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
         if token.State != "LOCKED" {
                 return fmt.Errorf("token %s is not in a LOCKED state for energy delivery (current state: %s)", tokenID, token.State)
         }
-        // Mark that the seller has delivered the energy (e.g., via meter data)
-        token.SellerDelivered = true
-        tokenBytes, _ = json.Marshal(token)
+
+        seller, err := loadParticipant(ctx, token.SellerID)
+        if err != nil {
+                return err
+        }
+        if seller.MeterPublicKey == "" {
+                return fmt.Errorf("seller %s has no meter public key registered", token.SellerID)
+        }
+        valid, err := verifyMeterSignature(seller.MeterPublicKey, readingJSON, signatureHex)
+        if err != nil {
+                return fmt.Errorf("meter signature verification failed: %v", err)
+        }
+        if !valid {
+                return fmt.Errorf("meter reading signature is invalid for seller %s", token.SellerID)
+        }
+
+        var reading MeterReading
+        if err := json.Unmarshal([]byte(readingJSON), &reading); err != nil {
+                return fmt.Errorf("failed to unmarshal meter reading: %v", err)
+        }
+        if len(token.MeterReadings) > 0 {
+                last := token.MeterReadings[len(token.MeterReadings)-1]
+                if reading.Timestamp < last.Timestamp {
+                        return fmt.Errorf("meter reading timestamp (%d) is before the last recorded reading (%d)", reading.Timestamp, last.Timestamp)
+                }
+                if reading.CumulativeKWh < last.CumulativeKWh {
+                        return fmt.Errorf("meter reading cumulative kWh (%f) is below the last recorded reading (%f)", reading.CumulativeKWh, last.CumulativeKWh)
+                }
+        }
+        reading.SignatureHex = signatureHex
+        token.MeterReadings = append(token.MeterReadings, reading)
+        token.DeliveredAmount = reading.CumulativeKWh
+        token.SellerDelivered = token.DeliveredAmount >= float64(token.EnergyAmount)
+
+        tokenBytes, err = json.Marshal(token)
+        if err != nil {
+                return fmt.Errorf("failed to marshal token: %v", err)
+        }
         return ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes)
 }
 
+// verifyMeterSignature checks signatureHex against sha256(readingJSON) using
+// a seller's registered MeterPublicKey, the same raw-JSON-string signing
+// convention SignedOrder uses (see verifyAndMintSignedMatch) so the caller
+// never has to worry about the contract re-serializing the reading
+// differently than it was signed.
+func verifyMeterSignature(meterPublicKeyPem string, readingJSON string, signatureHex string) (bool, error) {
+        pubKey, err := parseECDSAPublicKeyPEM(meterPublicKeyPem)
+        if err != nil {
+                return false, err
+        }
+        sigBytes, err := hex.DecodeString(signatureHex)
+        if err != nil {
+                return false, fmt.Errorf("invalid signature format: %v", err)
+        }
+        var sigStruct struct{ R, S *big.Int }
+        if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
+                return false, fmt.Errorf("failed to parse signature: %v", err)
+        }
+        hash := sha256.Sum256([]byte(readingJSON))
+        return ecdsa.Verify(pubKey, hash[:], sigStruct.R, sigStruct.S), nil
+}
+
 // ProcessCashFlow simulates the confirmation of payment for a given transaction (token).
 // It marks the token as payment completed by the buyer.
 func (s *SmartContract) ProcessCashFlow(ctx contractapi.TransactionContextInterface, tokenID string) error {
@@ -580,6 +1639,9 @@ func (s *SmartContract) ProcessCashFlow(ctx contractapi.TransactionContextInterf
 // SettleTransaction finalizes the transaction represented by the token.
 // If both energy and payment are confirmed, it marks the trade SUCCESS and releases deposits (and transfers payment).
 // If either party defaulted, it marks DEFAULT, penalizes the defaulter's deposit, and compensates the other party.
+// Tokens whose EnergyAmount*Price meets or exceeds the configured notary value
+// threshold (see SetNotaryValueThreshold) are rejected here and must go through
+// NotarySettleTransaction instead.
 func (s *SmartContract) SettleTransaction(ctx contractapi.TransactionContextInterface, tokenID string) error {
         tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
         if err != nil {
@@ -590,83 +1652,109 @@ func (s *SmartContract) SettleTransaction(ctx contractapi.TransactionContextInte
         }
         var token EnergyToken
         _ = json.Unmarshal(tokenBytes, &token)
-        if token.State != "LOCKED" {
-                return fmt.Errorf("transaction %s is already settled (state: %s)", tokenID, token.State)
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
         }
-        // Fetch buyer and seller participants
-        buyerBytes, _ := ctx.GetStub().GetState(participantKey(token.BuyerID))
-        sellerBytes, _ := ctx.GetStub().GetState(participantKey(token.SellerID))
-        if buyerBytes == nil || sellerBytes == nil {
-                return fmt.Errorf("participants for token %s not found", tokenID)
+        if cfg.ValueThreshold > 0 && token.EnergyAmount*token.Price >= cfg.ValueThreshold {
+                return fmt.Errorf("transaction %s value meets or exceeds the notary settlement threshold (%d); use NotarySettleTransaction", tokenID, cfg.ValueThreshold)
+        }
+        return settleLockedToken(ctx, tokenID)
+}
+
+// settleLockedToken contains the actual settlement logic shared by
+// SettleTransaction (direct settle, below the notary value threshold) and
+// NotarySettleTransaction (after its own M-of-N signature check).
+func settleLockedToken(ctx contractapi.TransactionContextInterface, tokenID string) error {
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read token: %v", err)
+        }
+        if tokenBytes == nil {
+                return fmt.Errorf("transaction token %s not found", tokenID)
+        }
+        var token EnergyToken
+        _ = json.Unmarshal(tokenBytes, &token)
+        if token.State != "LOCKED" {
+                return fmt.Errorf("transaction %s is already settled (state: %s)", tokenID, token.State)
+        }
+        // Fetch buyer and seller participants
+        buyerBytes, _ := ctx.GetStub().GetState(participantKey(token.BuyerID))
+        sellerBytes, _ := ctx.GetStub().GetState(participantKey(token.SellerID))
+        if buyerBytes == nil || sellerBytes == nil {
+                return fmt.Errorf("participants for token %s not found", tokenID)
         }
         var buyer, seller Participant
         _ = json.Unmarshal(buyerBytes, &buyer)
         _ = json.Unmarshal(sellerBytes, &seller)
+
+        // deliveredAmt is DeliveredAmount clamped to [0, EnergyAmount]; shortfall is
+        // the fraction of the order the seller never delivered.
+        deliveredAmt := token.DeliveredAmount
+        if deliveredAmt > float64(token.EnergyAmount) {
+                deliveredAmt = float64(token.EnergyAmount)
+        }
+        if deliveredAmt < 0 {
+                deliveredAmt = 0
+        }
+        shortfallRatio := 0.0
+        if token.EnergyAmount > 0 {
+                shortfallRatio = (float64(token.EnergyAmount) - deliveredAmt) / float64(token.EnergyAmount)
+        }
+
         // Determine outcome of the transaction
-        if token.SellerDelivered && token.BuyerPaid {
-                // Successful transaction
-                token.State = "SUCCESS"
-                // Transfer payment from buyer to seller
-                totalValue := token.EnergyAmount * token.Price
-                if buyer.Balance < totalValue {
-                        // Buyer cannot pay full amount (treat as buyer default)
+        if token.BuyerPaid {
+                // Buyer pays only for what the meter actually confirmed as delivered.
+                owedPayment := int(deliveredAmt * float64(token.Price))
+                if buyer.Balance < owedPayment {
+                        // Buyer cannot cover even the prorated amount (treat as buyer default)
                         token.State = "DEFAULT"
-                        // Buyer default: seller receives buyer's deposit as compensation
+                        token.BuyerPaid = false
                         seller.Balance += token.BuyerDeposit
-                        // Seller's deposit returned to seller
                         seller.Balance += token.SellerDeposit
-                        // Buyer's deposit is forfeited (remains deducted)
                         token.BuyerDeposit = 0
                         token.SellerDeposit = 0
-                        // Update state and participants
                         buyerBytes, _ = json.Marshal(buyer)
                         sellerBytes, _ = json.Marshal(seller)
                         ctx.GetStub().PutState(participantKey(buyer.ID), buyerBytes)
                         ctx.GetStub().PutState(participantKey(seller.ID), sellerBytes)
                         tokenBytes, _ = json.Marshal(token)
                         ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes)
-                        return nil
+                        return emitTokenEvent(ctx, "TransactionSettled", &token)
                 }
-                // Deduct payment from buyer and credit to seller
-                buyer.Balance -= totalValue
-                seller.Balance += totalValue
-                // Return deposits to both parties
-                buyer.Balance += token.BuyerDeposit
-                seller.Balance += token.SellerDeposit
-                // Deposits are released
+                token.State = "SUCCESS"
+                // Transfer the prorated payment from buyer to seller
+                buyer.Balance -= owedPayment
+                seller.Balance += owedPayment
+                // Seller's deposit is slashed proportionally to the undelivered shortfall;
+                // the forfeited portion compensates the buyer for the energy they didn't get
+                sellerForfeit := int(float64(token.SellerDeposit) * shortfallRatio)
+                seller.Balance += token.SellerDeposit - sellerForfeit
+                buyer.Balance += token.BuyerDeposit + sellerForfeit
                 token.BuyerDeposit = 0
                 token.SellerDeposit = 0
-                // Update participant balances in state
+                // Track traded volume (full order value) so dispute slashing can scale to trading history
+                totalValue := token.EnergyAmount * token.Price
+                buyer.TotalTradedVolume += totalValue
+                seller.TotalTradedVolume += totalValue
                 buyerBytes, _ = json.Marshal(buyer)
                 sellerBytes, _ = json.Marshal(seller)
                 ctx.GetStub().PutState(participantKey(buyer.ID), buyerBytes)
                 ctx.GetStub().PutState(participantKey(seller.ID), sellerBytes)
         } else {
-                // Default scenario (one or both did not complete obligations)
+                // Buyer never confirmed payment; no money changes hands, only deposits.
                 token.State = "DEFAULT"
-                if token.SellerDelivered && !token.BuyerPaid {
-                        // Buyer defaulted (energy delivered, payment not made)
-                        // Seller keeps buyer's deposit
+                if token.SellerDelivered {
+                        // Seller fully delivered but buyer withheld payment: seller keeps both deposits
                         seller.Balance += token.BuyerDeposit
-                        // Seller's deposit returned to seller
                         seller.Balance += token.SellerDeposit
-                } else if !token.SellerDelivered && token.BuyerPaid {
-                        // Seller defaulted (payment made, energy not delivered)
-                        // Buyer keeps seller's deposit
-                        buyer.Balance += token.SellerDeposit
-                        // Buyer's deposit returned to buyer
-                        buyer.Balance += token.BuyerDeposit
                 } else {
-                        // Neither delivered nor paid (seller failed to deliver, buyer withheld payment)
-                        // Buyer gets seller's deposit
+                        // Seller didn't fully deliver either: buyer gets both deposits back
                         buyer.Balance += token.SellerDeposit
-                        // Buyer's deposit returned to buyer
                         buyer.Balance += token.BuyerDeposit
                 }
-                // Deducted deposits remain accounted; set to 0 in token
                 token.BuyerDeposit = 0
                 token.SellerDeposit = 0
-                // Update participant balances
                 buyerBytes, _ = json.Marshal(buyer)
                 sellerBytes, _ = json.Marshal(seller)
                 ctx.GetStub().PutState(participantKey(buyer.ID), buyerBytes)
@@ -674,11 +1762,78 @@ func (s *SmartContract) SettleTransaction(ctx contractapi.TransactionContextInte
         }
         // Save updated token state
         tokenBytes, _ = json.Marshal(token)
-        return ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes)
+        if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
+                return err
+        }
+        return emitTokenEvent(ctx, "TransactionSettled", &token)
+}
+
+// ExpireTransaction allows anyone to force-settle a token that has sat LOCKED past
+// both its DeliveryDeadline and PaymentDeadline. Rather than re-deriving its own
+// success/default split, it delegates the actual outcome to settleLockedToken (the
+// same logic SettleTransaction uses), so a token that in fact completed — BuyerPaid
+// and fully/partially delivered — settles as SUCCESS here too instead of being
+// misclassified as a default just because nobody called SettleTransaction before
+// the deadline passed. It then emits its own TransactionExpired event on top of
+// settleLockedToken's TransactionSettled one, and rolls the outcome into reputation
+// via UpdateReputationScores, so a disappearing counterparty can no longer freeze a
+// token or its deposits forever.
+func (s *SmartContract) ExpireTransaction(ctx contractapi.TransactionContextInterface, tokenID string) error {
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read token: %v", err)
+        }
+        if tokenBytes == nil {
+                return fmt.Errorf("transaction token %s not found", tokenID)
+        }
+        var token EnergyToken
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
+        if token.State != "LOCKED" {
+                return fmt.Errorf("transaction %s is not awaiting settlement (state: %s)", tokenID, token.State)
+        }
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        now := txTime.GetSeconds()
+        if now <= token.DeliveryDeadline || now <= token.PaymentDeadline {
+                return fmt.Errorf("transaction %s has not yet passed both its delivery and payment deadlines", tokenID)
+        }
+
+        if err := settleLockedToken(ctx, tokenID); err != nil {
+                return err
+        }
+
+        settledBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read settled token: %v", err)
+        }
+        var settled EnergyToken
+        if err := json.Unmarshal(settledBytes, &settled); err != nil {
+                return fmt.Errorf("failed to unmarshal settled token: %v", err)
+        }
+        if err := emitTokenEvent(ctx, "TransactionExpired", &settled); err != nil {
+                return err
+        }
+
+        return s.UpdateReputationScores(ctx, tokenID)
 }
 
-// UpdateReputationScores updates the reputation scores of the buyer and seller after a transaction is settled.
-// On success, both parties' reputation may increase. On default, the defaulter's reputation is significantly decreased.
+// UpdateReputationScores folds a settled transaction's outcome into the
+// buyer's and seller's Reputation via an exponentially-weighted moving
+// average (see tradeAlpha/ewmaBlend), blending each party toward an outcome
+// score. The buyer's is maxReputation on SUCCESS, maxReputation/2 when it
+// paid but the trade still DEFAULTed, and zero when it is at fault. The
+// seller's is maxReputation/2 when it delivered but the buyer defaulted, and
+// otherwise (on SUCCESS and on a seller default alike) maxReputation scaled
+// by the fraction of EnergyAmount actually delivered. An at-fault party also
+// takes an escalating slash on top of the blend — reputationSlashBase times
+// one plus their defaults in the last defaultsLookbackSeconds. It
+// also updates the buyer/seller pair's directional rating regardless of
+// fault.
 func (s *SmartContract) UpdateReputationScores(ctx contractapi.TransactionContextInterface, tokenID string) error {
         tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
         if err != nil {
@@ -697,61 +1852,102 @@ func (s *SmartContract) UpdateReputationScores(ctx contractapi.TransactionContex
                 return fmt.Errorf("transaction %s is not settled yet (state: %s)", tokenID, token.State)
         }
 
-        buyerBytes, err := ctx.GetStub().GetState(participantKey(token.BuyerID))
-        if err != nil || buyerBytes == nil {
-                return fmt.Errorf("buyer %s not found", token.BuyerID)
+        buyer, err := loadParticipant(ctx, token.BuyerID)
+        if err != nil {
+                return err
         }
-        var buyer Participant
-        if err := json.Unmarshal(buyerBytes, &buyer); err != nil {
-                return fmt.Errorf("failed to unmarshal buyer: %v", err)
+        seller, err := loadParticipant(ctx, token.SellerID)
+        if err != nil {
+                return err
         }
 
-        sellerBytes, err := ctx.GetStub().GetState(participantKey(token.SellerID))
-        if err != nil || sellerBytes == nil {
-                return fmt.Errorf("seller %s not found", token.SellerID)
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
         }
-        var seller Participant
-        if err := json.Unmarshal(sellerBytes, &seller); err != nil {
-                return fmt.Errorf("failed to unmarshal seller: %v", err)
+        now := txTime.GetSeconds()
+
+        success := token.State == "SUCCESS"
+        totalValue := token.EnergyAmount * token.Price
+        alphaScaled, err := tradeAlpha(ctx, totalValue)
+        if err != nil {
+                return err
         }
 
-        const maxReputation = 100
-        const penalty = 5
+        // deliveryRatio is the continuous outcome signal for the seller's side:
+        // how much of EnergyAmount the meter readings actually confirmed, rather
+        // than the old binary SellerDelivered flip.
+        deliveryRatio := 1.0
+        if token.EnergyAmount > 0 {
+                deliveryRatio = token.DeliveredAmount / float64(token.EnergyAmount)
+        }
+        if deliveryRatio > 1 {
+                deliveryRatio = 1
+        }
+        if deliveryRatio < 0 {
+                deliveryRatio = 0
+        }
+        sellerDeliveryOutcome := int(float64(maxReputation) * deliveryRatio)
 
-        switch token.State {
-        case "SUCCESS":
-                // Successful trade: increase both reputations by 1 (up to maxReputation)
-                if buyer.Reputation < maxReputation {
-                        buyer.Reputation++
-                }
-                if seller.Reputation < maxReputation {
-                        seller.Reputation++
-                }
-        case "DEFAULT":
-                // Default: penalize the defaulter's reputation
-                if token.SellerDelivered && !token.BuyerPaid {
-                        // Buyer defaulted on payment
-                        buyer.Reputation -= penalty
-                        if buyer.Reputation < 0 {
-                                buyer.Reputation = 0
-                        }
-                } else if !token.SellerDelivered && token.BuyerPaid {
-                        // Seller defaulted on delivery
-                        seller.Reputation -= penalty
-                        if seller.Reputation < 0 {
-                                seller.Reputation = 0
-                        }
-                } else {
-                        // Neither delivered nor paid (treat as seller default)
-                        seller.Reputation -= penalty
-                        if seller.Reputation < 0 {
-                                seller.Reputation = 0
-                        }
+        buyerOutcome, sellerOutcome := maxReputation, maxReputation
+        var buyerAtFault, sellerAtFault bool
+        if success {
+                // Buyer paid in full for what was delivered; seller's reputation
+                // reflects how much of the order they actually delivered.
+                sellerOutcome = sellerDeliveryOutcome
+        } else {
+                // Check BuyerPaid first, mirroring settleLockedToken's own branch order,
+                // so a pair where both flags ended up true is never reachable here (it
+                // would have settled as SUCCESS above) instead of silently falling into
+                // the "neither" case and blaming the seller for a trade that went fine.
+                switch {
+                case token.BuyerPaid:
+                        // Seller defaulted on delivery; buyer held up their end, but the
+                        // trade still failed overall, so the buyer's outcome is the
+                        // counterparty-default score (0.5), not the success score (1.0).
+                        buyerOutcome, sellerOutcome = maxReputation/2, sellerDeliveryOutcome
+                        sellerAtFault = true
+                case token.SellerDelivered:
+                        // Buyer defaulted on payment; seller held up their end, so the
+                        // seller's outcome is the counterparty-default score (0.5), not
+                        // the success score (1.0).
+                        buyerOutcome, sellerOutcome = 0, maxReputation/2
+                        buyerAtFault = true
+                default:
+                        // Neither delivered nor paid: the buyer's own obligation (payment)
+                        // went unmet too, so it gets no upward blend here either — both
+                        // sides are at fault rather than crediting the buyer as if it were
+                        // the non-defaulting counterparty.
+                        buyerOutcome, sellerOutcome = 0, sellerDeliveryOutcome
+                        buyerAtFault = true
+                        sellerAtFault = true
                 }
         }
 
+        buyer.Reputation = ewmaBlend(buyer.Reputation, buyerOutcome, alphaScaled)
+        seller.Reputation = ewmaBlend(seller.Reputation, sellerOutcome, alphaScaled)
+
+        if buyerAtFault {
+                buyer.RecentDefaultTimes = append(pruneRecentDefaults(buyer.RecentDefaultTimes, now), now)
+                buyer.Reputation -= reputationSlashBase * (1 + len(buyer.RecentDefaultTimes))
+        }
+        if sellerAtFault {
+                seller.RecentDefaultTimes = append(pruneRecentDefaults(seller.RecentDefaultTimes, now), now)
+                seller.Reputation -= reputationSlashBase * (1 + len(seller.RecentDefaultTimes))
+        }
+        if buyer.Reputation < 0 {
+                buyer.Reputation = 0
+        }
+        if seller.Reputation < 0 {
+                seller.Reputation = 0
+        }
+
+        if err := updatePairRating(ctx, token.BuyerID, token.SellerID, alphaScaled, success); err != nil {
+                return err
+        }
+
         // Update participants' reputation in ledger
-        buyerBytes, err = json.Marshal(buyer)
+        buyerBytes, err := json.Marshal(buyer)
         if err != nil {
                 return fmt.Errorf("failed to marshal updated buyer: %v", err)
         }
@@ -759,7 +1955,7 @@ func (s *SmartContract) UpdateReputationScores(ctx contractapi.TransactionContex
                 return fmt.Errorf("failed to update buyer state: %v", err)
         }
 
-        sellerBytes, err = json.Marshal(seller)
+        sellerBytes, err := json.Marshal(seller)
         if err != nil {
                 return fmt.Errorf("failed to marshal updated seller: %v", err)
         }
@@ -772,20 +1968,23 @@ func (s *SmartContract) UpdateReputationScores(ctx contractapi.TransactionContex
 
 // QueryReputation returns the reputation of a participant by ID
 func (s *SmartContract) QueryReputation(ctx contractapi.TransactionContextInterface, participantID string) (int, error) {
-        participantJSON, err := ctx.GetStub().GetState(participantKey(participantID))
+        participant, err := loadParticipant(ctx, participantID)
         if err != nil {
-                return 0, fmt.Errorf("failed to get participant: %v", err)
-        }
-        if participantJSON == nil {
-                return 0, fmt.Errorf("participant %s does not exist", participantID)
+                return 0, err
         }
+        return participant.Reputation, nil
+}
 
-        var participant Participant
-        if err := json.Unmarshal(participantJSON, &participant); err != nil {
-                return 0, fmt.Errorf("failed to unmarshal participant: %v", err)
+// QueryPairReputation returns the directional rating built up between two
+// counterparties specifically (as opposed to either party's overall
+// Reputation), or the maxReputation/2 midpoint if the pair has never settled
+// a trade together.
+func (s *SmartContract) QueryPairReputation(ctx contractapi.TransactionContextInterface, buyerID string, sellerID string) (int, error) {
+        rating, err := loadPairRating(ctx, buyerID, sellerID)
+        if err != nil {
+                return 0, err
         }
-
-        return participant.Reputation, nil
+        return rating.Score, nil
 }
 
 // VerifySignature verifies an ECDSA signature (in hex format) on a given message using the participant's public key.
@@ -831,16 +2030,7 @@ func (s *SmartContract) VerifySignature(ctx contractapi.TransactionContextInterf
 
 // GetParticipant returns the Participant struct for a given participant ID
 func (s *SmartContract) GetParticipant(ctx contractapi.TransactionContextInterface, id string) (*Participant, error) {
-        data, err := ctx.GetStub().GetState(participantKey(id))
-        if err != nil {
-                return nil, fmt.Errorf("failed to read participant: %v", err)
-        }
-        if data == nil {
-                return nil, fmt.Errorf("participant %s does not exist", id)
-        }
-        var participant Participant
-        _ = json.Unmarshal(data, &participant)
-        return &participant, nil
+        return loadParticipant(ctx, id)
 }
 
 // GetOrder returns the Order struct for a given order ID
@@ -871,6 +2061,1310 @@ func (s *SmartContract) GetEnergyToken(ctx contractapi.TransactionContextInterfa
         return &token, nil
 }
 
+// ---------------------------------------------------------------------------
+// Reputation-collateralized lending subsystem
+//
+// Lenders post a LoanOffer promising funds at a fixed interest rate to any
+// borrower whose reputation clears a minimum bar. A borrower who takes the
+// offer receives the principal immediately into their Balance and has
+// reputation-scaled collateral locked (via calculateDepositPercent, the same
+// curve CreateOrder/IssueToken use for trading deposits). Repaying returns the
+// collateral to the borrower and principal+interest to the lender; failing to repay in time,
+// or letting reputation fall far enough that the locked collateral no longer
+// covers the loan, exposes the loan to liquidation in the lender's favor.
+// ---------------------------------------------------------------------------
+
+const loanOfferPrefix = "LOANOFFER_"
+const loanPrefix = "LOAN_"
+const lendingPoolKey = "LENDINGPOOL"
+const loanStateActive = "ACTIVE"
+const loanStateRepaid = "REPAID"
+const loanStateDefaulted = "DEFAULTED"
+const minCollateralCoverageRatio = 80 // loan is liquidatable once collateral covers less than 80% of the current requirement
+const loanDefaultPenalty = 1000       // reputation penalty applied to a borrower whose loan is liquidated (10.00 points)
+const loanRepaymentReward = 100       // reputation reward for repaying a loan in full (1.00 point)
+
+// LendingPool tracks aggregate liquidity supplied by lenders and principal
+// currently lent out, for reporting/solvency purposes.
+type LendingPool struct {
+        TotalSupplied          int `json:"totalSupplied"`
+        TotalOutstandingPrincipal int `json:"totalOutstandingPrincipal"`
+}
+
+// LoanOffer represents a lender's standing offer to lend up to Amount at
+// InterestBP (basis points) for Term seconds to any borrower whose reputation
+// is at least MinBorrowerReputation.
+type LoanOffer struct {
+        OfferID               string `json:"offerID"`
+        LenderID              string `json:"lenderID"`
+        Amount                int    `json:"amount"` // remaining amount available to lend
+        InterestBP            int    `json:"interestBP"`
+        Term                  int64  `json:"term"` // loan term in seconds
+        MinBorrowerReputation int    `json:"minBorrowerReputation"`
+        Open                  bool   `json:"open"`
+}
+
+// LoanAgreement represents a single draw against a LoanOffer.
+type LoanAgreement struct {
+        LoanID         string `json:"loanID"`
+        OfferID        string `json:"offerID"`
+        LenderID       string `json:"lenderID"`
+        BorrowerID     string `json:"borrowerID"`
+        Principal      int    `json:"principal"`
+        InterestBP     int    `json:"interestBP"`
+        Collateral     int    `json:"collateral"`
+        StartTimestamp int64  `json:"startTimestamp"`
+        DueTimestamp   int64  `json:"dueTimestamp"`
+        State          string `json:"state"` // "ACTIVE", "REPAID", or "DEFAULTED"
+}
+
+func loanOfferKey(id string) string { return loanOfferPrefix + id }
+func loanKey(id string) string      { return loanPrefix + id }
+
+// loadLendingPool reads the singleton LendingPool, defaulting to a zero-valued
+// pool if it has not been initialized yet.
+func loadLendingPool(ctx contractapi.TransactionContextInterface) (LendingPool, error) {
+        var pool LendingPool
+        raw, err := ctx.GetStub().GetState(lendingPoolKey)
+        if err != nil {
+                return pool, fmt.Errorf("failed to read lending pool: %v", err)
+        }
+        if raw != nil {
+                if err := json.Unmarshal(raw, &pool); err != nil {
+                        return pool, fmt.Errorf("failed to unmarshal lending pool: %v", err)
+                }
+        }
+        return pool, nil
+}
+
+func saveLendingPool(ctx contractapi.TransactionContextInterface, pool LendingPool) error {
+        raw, err := json.Marshal(pool)
+        if err != nil {
+                return fmt.Errorf("failed to marshal lending pool: %v", err)
+        }
+        return ctx.GetStub().PutState(lendingPoolKey, raw)
+}
+
+// availableBalance returns a participant's balance net of their running
+// OutstandingLoanObligation, floored at zero, for use in trading solvency
+// checks. CreateOrder and IssueToken use this to adjust the effective balance
+// available for new trading obligations, so an over-leveraged borrower cannot
+// also out-bid the market.
+func availableBalance(participant Participant) int {
+        available := participant.Balance - participant.OutstandingLoanObligation
+        if available < 0 {
+                available = 0
+        }
+        return available
+}
+
+// PostLoanOffer registers a new standing loan offer and escrows the offered
+// amount out of the lender's balance immediately, mirroring the deposit-lock
+// pattern IssueToken uses for trading collateral.
+func (s *SmartContract) PostLoanOffer(ctx contractapi.TransactionContextInterface, offerID string, lenderID string, amount int, interestBP int, term int64, minBorrowerReputation int) error {
+        existing, err := ctx.GetStub().GetState(loanOfferKey(offerID))
+        if err != nil {
+                return fmt.Errorf("failed to check loan offer existence: %v", err)
+        }
+        if existing != nil {
+                return fmt.Errorf("loan offer %s already exists", offerID)
+        }
+        if amount <= 0 {
+                return fmt.Errorf("loan offer amount must be positive")
+        }
+        if interestBP < 0 {
+                return fmt.Errorf("interest rate cannot be negative")
+        }
+        if term <= 0 {
+                return fmt.Errorf("loan term must be positive")
+        }
+
+        lenderJSON, err := ctx.GetStub().GetState(participantKey(lenderID))
+        if err != nil {
+                return fmt.Errorf("failed to read lender: %v", err)
+        }
+        if lenderJSON == nil {
+                return fmt.Errorf("lender %s does not exist", lenderID)
+        }
+        var lender Participant
+        if err := json.Unmarshal(lenderJSON, &lender); err != nil {
+                return fmt.Errorf("failed to unmarshal lender: %v", err)
+        }
+        if lender.Balance < amount {
+                return fmt.Errorf("lender %s has insufficient balance to fund offer, required: %d, current: %d", lenderID, amount, lender.Balance)
+        }
+
+        lender.Balance -= amount
+        lenderBytes, err := json.Marshal(lender)
+        if err != nil {
+                return fmt.Errorf("failed to marshal lender: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(lenderID), lenderBytes); err != nil {
+                return err
+        }
+
+        offer := LoanOffer{
+                OfferID:               offerID,
+                LenderID:              lenderID,
+                Amount:                amount,
+                InterestBP:            interestBP,
+                Term:                  term,
+                MinBorrowerReputation: minBorrowerReputation,
+                Open:                  true,
+        }
+        offerBytes, err := json.Marshal(offer)
+        if err != nil {
+                return fmt.Errorf("failed to marshal loan offer: %v", err)
+        }
+        if err := ctx.GetStub().PutState(loanOfferKey(offerID), offerBytes); err != nil {
+                return err
+        }
+
+        pool, err := loadLendingPool(ctx)
+        if err != nil {
+                return err
+        }
+        pool.TotalSupplied += amount
+        return saveLendingPool(ctx, pool)
+}
+
+// TakeLoan draws `amount` against an open LoanOffer. The borrower must clear
+// the offer's minimum reputation, and must hold enough balance to cover the
+// reputation-scaled collateral (calculateDepositPercent applied to the
+// requested amount). On success the collateral is locked, the principal is
+// credited to the borrower's balance, and a LoanAgreement is created in the
+// ACTIVE state.
+func (s *SmartContract) TakeLoan(ctx contractapi.TransactionContextInterface, loanID string, offerID string, borrowerID string, amount int) error {
+        existing, err := ctx.GetStub().GetState(loanKey(loanID))
+        if err != nil {
+                return fmt.Errorf("failed to check loan existence: %v", err)
+        }
+        if existing != nil {
+                return fmt.Errorf("loan %s already exists", loanID)
+        }
+        if amount <= 0 {
+                return fmt.Errorf("loan amount must be positive")
+        }
+
+        offerJSON, err := ctx.GetStub().GetState(loanOfferKey(offerID))
+        if err != nil {
+                return fmt.Errorf("failed to read loan offer: %v", err)
+        }
+        if offerJSON == nil {
+                return fmt.Errorf("loan offer %s does not exist", offerID)
+        }
+        var offer LoanOffer
+        if err := json.Unmarshal(offerJSON, &offer); err != nil {
+                return fmt.Errorf("failed to unmarshal loan offer: %v", err)
+        }
+        if !offer.Open || offer.Amount < amount {
+                return fmt.Errorf("loan offer %s cannot cover requested amount %d", offerID, amount)
+        }
+
+        borrowerPtr, err := loadParticipant(ctx, borrowerID)
+        if err != nil {
+                return err
+        }
+        borrower := *borrowerPtr
+        if borrower.Reputation < offer.MinBorrowerReputation {
+                return fmt.Errorf("borrower reputation (%d) below offer's minimum (%d)", borrower.Reputation, offer.MinBorrowerReputation)
+        }
+
+        collateral := (calculateDepositPercent(borrower.Reputation) * amount) / 100
+        if borrower.Balance < collateral {
+                return fmt.Errorf("borrower %s has insufficient balance for collateral, required: %d, current: %d", borrowerID, collateral, borrower.Balance)
+        }
+
+        borrower.Balance -= collateral
+        borrower.Balance += amount
+        interest := (amount * offer.InterestBP) / 10000
+        borrower.OutstandingLoanObligation += amount + interest
+        borrowerBytes, err := json.Marshal(borrower)
+        if err != nil {
+                return fmt.Errorf("failed to marshal borrower: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(borrowerID), borrowerBytes); err != nil {
+                return err
+        }
+
+        offer.Amount -= amount
+        if offer.Amount == 0 {
+                offer.Open = false
+        }
+        offerBytes, err := json.Marshal(offer)
+        if err != nil {
+                return fmt.Errorf("failed to marshal loan offer: %v", err)
+        }
+        if err := ctx.GetStub().PutState(loanOfferKey(offerID), offerBytes); err != nil {
+                return err
+        }
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        startSeconds := txTime.GetSeconds()
+
+        loan := LoanAgreement{
+                LoanID:         loanID,
+                OfferID:        offerID,
+                LenderID:       offer.LenderID,
+                BorrowerID:     borrowerID,
+                Principal:      amount,
+                InterestBP:     offer.InterestBP,
+                Collateral:     collateral,
+                StartTimestamp: startSeconds,
+                DueTimestamp:   startSeconds + offer.Term,
+                State:          loanStateActive,
+        }
+        loanBytes, err := json.Marshal(loan)
+        if err != nil {
+                return fmt.Errorf("failed to marshal loan: %v", err)
+        }
+        if err := ctx.GetStub().PutState(loanKey(loanID), loanBytes); err != nil {
+                return err
+        }
+
+        pool, err := loadLendingPool(ctx)
+        if err != nil {
+                return err
+        }
+        pool.TotalOutstandingPrincipal += amount
+        return saveLendingPool(ctx, pool)
+}
+
+// RepayLoan settles an ACTIVE loan: the borrower pays principal+interest to
+// the lender and has their collateral released. The borrower's reputation
+// ticks up, reinforcing good borrowing behavior the same way a SUCCESS trade
+// does in UpdateReputationScores.
+func (s *SmartContract) RepayLoan(ctx contractapi.TransactionContextInterface, loanID string) error {
+        loanJSON, err := ctx.GetStub().GetState(loanKey(loanID))
+        if err != nil {
+                return fmt.Errorf("failed to read loan: %v", err)
+        }
+        if loanJSON == nil {
+                return fmt.Errorf("loan %s does not exist", loanID)
+        }
+        var loan LoanAgreement
+        if err := json.Unmarshal(loanJSON, &loan); err != nil {
+                return fmt.Errorf("failed to unmarshal loan: %v", err)
+        }
+        if loan.State != loanStateActive {
+                return fmt.Errorf("loan %s is not active (state: %s)", loanID, loan.State)
+        }
+
+        borrowerPtr, err := loadParticipant(ctx, loan.BorrowerID)
+        if err != nil {
+                return err
+        }
+        borrower := *borrowerPtr
+
+        lenderPtr, err := loadParticipant(ctx, loan.LenderID)
+        if err != nil {
+                return err
+        }
+        lender := *lenderPtr
+
+        interest := (loan.Principal * loan.InterestBP) / 10000
+        repayment := loan.Principal + interest
+        if borrower.Balance < repayment {
+                return fmt.Errorf("borrower %s has insufficient balance to repay, required: %d, current: %d", loan.BorrowerID, repayment, borrower.Balance)
+        }
+
+        borrower.Balance -= repayment
+        borrower.Balance += loan.Collateral
+        borrower.OutstandingLoanObligation -= repayment
+        if borrower.OutstandingLoanObligation < 0 {
+                borrower.OutstandingLoanObligation = 0
+        }
+        if borrower.Reputation < maxReputation {
+                borrower.Reputation += loanRepaymentReward
+                if borrower.Reputation > maxReputation {
+                        borrower.Reputation = maxReputation
+                }
+        }
+        lender.Balance += repayment
+
+        loan.State = loanStateRepaid
+        loan.Collateral = 0
+
+        borrowerBytes, err := json.Marshal(borrower)
+        if err != nil {
+                return fmt.Errorf("failed to marshal borrower: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(borrower.ID), borrowerBytes); err != nil {
+                return err
+        }
+        lenderBytes, err := json.Marshal(lender)
+        if err != nil {
+                return fmt.Errorf("failed to marshal lender: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(lender.ID), lenderBytes); err != nil {
+                return err
+        }
+        loanBytes, err := json.Marshal(loan)
+        if err != nil {
+                return fmt.Errorf("failed to marshal loan: %v", err)
+        }
+        if err := ctx.GetStub().PutState(loanKey(loan.LoanID), loanBytes); err != nil {
+                return err
+        }
+
+        pool, err := loadLendingPool(ctx)
+        if err != nil {
+                return err
+        }
+        pool.TotalOutstandingPrincipal -= loan.Principal
+        if pool.TotalOutstandingPrincipal < 0 {
+                pool.TotalOutstandingPrincipal = 0
+        }
+        return saveLendingPool(ctx, pool)
+}
+
+// LiquidateLoan transfers a defaulting borrower's collateral to the lender.
+// A loan becomes liquidatable once its term has elapsed, or once the
+// borrower's reputation has fallen enough that the collateral locked at
+// origination would no longer meet calculateDepositPercent's requirement for
+// the borrower's current reputation by at least minCollateralCoverageRatio.
+func (s *SmartContract) LiquidateLoan(ctx contractapi.TransactionContextInterface, loanID string) error {
+        loanJSON, err := ctx.GetStub().GetState(loanKey(loanID))
+        if err != nil {
+                return fmt.Errorf("failed to read loan: %v", err)
+        }
+        if loanJSON == nil {
+                return fmt.Errorf("loan %s does not exist", loanID)
+        }
+        var loan LoanAgreement
+        if err := json.Unmarshal(loanJSON, &loan); err != nil {
+                return fmt.Errorf("failed to unmarshal loan: %v", err)
+        }
+        if loan.State != loanStateActive {
+                return fmt.Errorf("loan %s is not active (state: %s)", loanID, loan.State)
+        }
+
+        borrowerPtr, err := loadParticipant(ctx, loan.BorrowerID)
+        if err != nil {
+                return err
+        }
+        borrower := *borrowerPtr
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        now := txTime.GetSeconds()
+
+        pastTerm := now >= loan.DueTimestamp
+        requiredCollateral := (calculateDepositPercent(borrower.Reputation) * loan.Principal) / 100
+        underCollateralized := loan.Collateral*100 < requiredCollateral*minCollateralCoverageRatio
+        if !pastTerm && !underCollateralized {
+                return fmt.Errorf("loan %s is not yet eligible for liquidation", loanID)
+        }
+
+        lenderPtr, err := loadParticipant(ctx, loan.LenderID)
+        if err != nil {
+                return err
+        }
+        lender := *lenderPtr
+
+        lender.Balance += loan.Collateral
+        loan.Collateral = 0
+        loan.State = loanStateDefaulted
+
+        interest := (loan.Principal * loan.InterestBP) / 10000
+        borrower.OutstandingLoanObligation -= loan.Principal + interest
+        if borrower.OutstandingLoanObligation < 0 {
+                borrower.OutstandingLoanObligation = 0
+        }
+
+        borrower.Reputation -= loanDefaultPenalty
+        if borrower.Reputation < 0 {
+                borrower.Reputation = 0
+        }
+
+        lenderBytes, err := json.Marshal(lender)
+        if err != nil {
+                return fmt.Errorf("failed to marshal lender: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(lender.ID), lenderBytes); err != nil {
+                return err
+        }
+        borrowerBytes, err := json.Marshal(borrower)
+        if err != nil {
+                return fmt.Errorf("failed to marshal borrower: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(borrower.ID), borrowerBytes); err != nil {
+                return err
+        }
+        loanBytes, err := json.Marshal(loan)
+        if err != nil {
+                return fmt.Errorf("failed to marshal loan: %v", err)
+        }
+        if err := ctx.GetStub().PutState(loanKey(loan.LoanID), loanBytes); err != nil {
+                return err
+        }
+
+        pool, err := loadLendingPool(ctx)
+        if err != nil {
+                return err
+        }
+        pool.TotalOutstandingPrincipal -= loan.Principal
+        if pool.TotalOutstandingPrincipal < 0 {
+                pool.TotalOutstandingPrincipal = 0
+        }
+        return saveLendingPool(ctx, pool)
+}
+
+// GetLoanOffer returns the LoanOffer struct for a given offer ID
+func (s *SmartContract) GetLoanOffer(ctx contractapi.TransactionContextInterface, offerID string) (*LoanOffer, error) {
+        data, err := ctx.GetStub().GetState(loanOfferKey(offerID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read loan offer: %v", err)
+        }
+        if data == nil {
+                return nil, fmt.Errorf("loan offer %s does not exist", offerID)
+        }
+        var offer LoanOffer
+        _ = json.Unmarshal(data, &offer)
+        return &offer, nil
+}
+
+// GetLoanAgreement returns the LoanAgreement struct for a given loan ID
+func (s *SmartContract) GetLoanAgreement(ctx contractapi.TransactionContextInterface, loanID string) (*LoanAgreement, error) {
+        data, err := ctx.GetStub().GetState(loanKey(loanID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read loan: %v", err)
+        }
+        if data == nil {
+                return nil, fmt.Errorf("loan %s does not exist", loanID)
+        }
+        var loan LoanAgreement
+        _ = json.Unmarshal(data, &loan)
+        return &loan, nil
+}
+
+// ---------------------------------------------------------------------------
+// Governance-controlled market halt / circuit breaker
+//
+// Operators can freeze trading at three scopes: GLOBAL (the whole market),
+// PARTICIPANT (a single participant cannot trade), or PAIR (a specific
+// buyer+seller combination cannot trade with each other). CreateOrder,
+// PerformMarketMatching, and IssueToken consult the registry before
+// proceeding so an operator can respond to a suspected exploit or disputed
+// settlement without redeploying the chaincode.
+// ---------------------------------------------------------------------------
+
+const haltPrefix = "HALT_"
+const scopeGlobal = "GLOBAL"
+const scopeParticipant = "PARTICIPANT"
+const scopePair = "PAIR"
+const adminMSPID = "RepuTradeOperatorMSP" // MSP identity authorized to manage market halts
+
+// MarketHalt records a single halt entered under SetHalt. It is looked up
+// lazily: a halt is only "active" while ctx.GetTxTimestamp() is before
+// UntilTimestamp, so an expired halt does not need to be explicitly cleared.
+type MarketHalt struct {
+        Scope          string `json:"scope"`    // "GLOBAL", "PARTICIPANT", or "PAIR"
+        TargetID       string `json:"targetID"` // participant ID for PARTICIPANT, "buyerID|sellerID" for PAIR, empty for GLOBAL
+        UntilTimestamp int64  `json:"untilTimestamp"`
+        Reason         string `json:"reason"`
+}
+
+// haltKey builds the state key for a halt at the given scope/target.
+func haltKey(scope string, targetID string) string {
+        return haltPrefix + scope + "_" + targetID
+}
+
+// pairTargetID builds the PAIR-scope target ID for a buyer/seller combination.
+// The two IDs are sorted before joining so the key is direction-independent:
+// a halt doesn't care which side of the trade each participant is on, and a
+// buyer/seller pairing reversed on the opposite side's order must still hit
+// the same key.
+func pairTargetID(buyerID string, sellerID string) string {
+        a, b := buyerID, sellerID
+        if b < a {
+                a, b = b, a
+        }
+        return a + "|" + b
+}
+
+// normalizePairTargetID re-sorts an admin-supplied PAIR-scope targetID
+// ("idA|idB") into pairTargetID's canonical order, so a halt set via SetHalt
+// matches checkTradeHalt's lookup regardless of which ID the admin listed
+// first.
+func normalizePairTargetID(targetID string) (string, error) {
+        parts := strings.SplitN(targetID, "|", 2)
+        if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+                return "", fmt.Errorf("PAIR targetID must be of the form \"buyerID|sellerID\", got %q", targetID)
+        }
+        return pairTargetID(parts[0], parts[1]), nil
+}
+
+// isAdmin reports whether the invoking client belongs to the MSP authorized
+// to manage market halts.
+func isAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+        mspID, err := ctx.GetClientIdentity().GetMSPID()
+        if err != nil {
+                return false, fmt.Errorf("failed to get client MSP ID: %v", err)
+        }
+        return mspID == adminMSPID, nil
+}
+
+// activeHalt loads the halt at the given scope/target, returning nil if none
+// exists or if it has expired.
+func activeHalt(ctx contractapi.TransactionContextInterface, scope string, targetID string) (*MarketHalt, error) {
+        raw, err := ctx.GetStub().GetState(haltKey(scope, targetID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read market halt: %v", err)
+        }
+        if raw == nil {
+                return nil, nil
+        }
+        var halt MarketHalt
+        if err := json.Unmarshal(raw, &halt); err != nil {
+                return nil, fmt.Errorf("failed to unmarshal market halt: %v", err)
+        }
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        if txTime.GetSeconds() >= halt.UntilTimestamp {
+                return nil, nil
+        }
+        return &halt, nil
+}
+
+// checkParticipantHalt refuses a transaction if a GLOBAL halt or a
+// PARTICIPANT halt targeting participantID is currently active.
+func checkParticipantHalt(ctx contractapi.TransactionContextInterface, participantID string) error {
+        global, err := activeHalt(ctx, scopeGlobal, "")
+        if err != nil {
+                return err
+        }
+        if global != nil {
+                return fmt.Errorf("market is halted (reason: %s)", global.Reason)
+        }
+        participant, err := activeHalt(ctx, scopeParticipant, participantID)
+        if err != nil {
+                return err
+        }
+        if participant != nil {
+                return fmt.Errorf("participant %s is halted (reason: %s)", participantID, participant.Reason)
+        }
+        return nil
+}
+
+// checkTradeHalt additionally refuses a transaction if a PAIR halt targeting
+// this buyer/seller combination is currently active.
+func checkTradeHalt(ctx contractapi.TransactionContextInterface, buyerID string, sellerID string) error {
+        if err := checkParticipantHalt(ctx, buyerID); err != nil {
+                return err
+        }
+        if err := checkParticipantHalt(ctx, sellerID); err != nil {
+                return err
+        }
+        pair, err := activeHalt(ctx, scopePair, pairTargetID(buyerID, sellerID))
+        if err != nil {
+                return err
+        }
+        if pair != nil {
+                return fmt.Errorf("trading between %s and %s is halted (reason: %s)", buyerID, sellerID, pair.Reason)
+        }
+        return nil
+}
+
+// SetHalt freezes trading at the given scope until untilTimestamp (unix
+// seconds). scope must be "GLOBAL", "PARTICIPANT", or "PAIR"; targetID is
+// ignored for GLOBAL, a participant ID for PARTICIPANT, or "buyerID|sellerID"
+// for PAIR. Restricted to the admin MSP.
+func (s *SmartContract) SetHalt(ctx contractapi.TransactionContextInterface, scope string, targetID string, untilTimestamp int64, reason string) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may set market halts")
+        }
+        if scope != scopeGlobal && scope != scopeParticipant && scope != scopePair {
+                return fmt.Errorf("scope must be GLOBAL, PARTICIPANT, or PAIR")
+        }
+        if scope == scopeGlobal {
+                targetID = ""
+        } else if targetID == "" {
+                return fmt.Errorf("targetID is required for scope %s", scope)
+        } else if scope == scopePair {
+                normalized, err := normalizePairTargetID(targetID)
+                if err != nil {
+                        return err
+                }
+                targetID = normalized
+        }
+
+        halt := MarketHalt{
+                Scope:          scope,
+                TargetID:       targetID,
+                UntilTimestamp: untilTimestamp,
+                Reason:         reason,
+        }
+        haltBytes, err := json.Marshal(halt)
+        if err != nil {
+                return fmt.Errorf("failed to marshal market halt: %v", err)
+        }
+        if err := ctx.GetStub().PutState(haltKey(scope, targetID), haltBytes); err != nil {
+                return err
+        }
+        return ctx.GetStub().SetEvent("MarketHalted", haltBytes)
+}
+
+// ClearHalt lifts a previously-set halt at the given scope/target. Restricted
+// to the admin MSP.
+func (s *SmartContract) ClearHalt(ctx contractapi.TransactionContextInterface, scope string, targetID string) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may clear market halts")
+        }
+        if scope == scopeGlobal {
+                targetID = ""
+        } else if scope == scopePair {
+                normalized, err := normalizePairTargetID(targetID)
+                if err != nil {
+                        return err
+                }
+                targetID = normalized
+        }
+        key := haltKey(scope, targetID)
+        existing, err := ctx.GetStub().GetState(key)
+        if err != nil {
+                return fmt.Errorf("failed to read market halt: %v", err)
+        }
+        if existing == nil {
+                return fmt.Errorf("no halt set for scope %s target %s", scope, targetID)
+        }
+        if err := ctx.GetStub().DelState(key); err != nil {
+                return err
+        }
+        eventBytes, err := json.Marshal(MarketHalt{Scope: scope, TargetID: targetID})
+        if err != nil {
+                return fmt.Errorf("failed to marshal resume event: %v", err)
+        }
+        return ctx.GetStub().SetEvent("MarketResumed", eventBytes)
+}
+
+// QueryActiveHalts returns every halt currently in force (GLOBAL, PARTICIPANT,
+// and PAIR), skipping entries whose UntilTimestamp has already passed.
+func (s *SmartContract) QueryActiveHalts(ctx contractapi.TransactionContextInterface) ([]MarketHalt, error) {
+        iter, err := ctx.GetStub().GetStateByRange(haltPrefix, haltPrefix+"~")
+        if err != nil {
+                return nil, fmt.Errorf("failed to range over market halts: %v", err)
+        }
+        defer iter.Close()
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+
+        var halts []MarketHalt
+        for iter.HasNext() {
+                kv, err := iter.Next()
+                if err != nil {
+                        return nil, fmt.Errorf("error iterating market halts: %v", err)
+                }
+                var halt MarketHalt
+                if err := json.Unmarshal(kv.Value, &halt); err != nil {
+                        continue
+                }
+                if txTime.GetSeconds() >= halt.UntilTimestamp {
+                        continue
+                }
+                halts = append(halts, halt)
+        }
+        return halts, nil
+}
+
+// ---------------------------------------------------------------------------
+// Dispute resolution and slashing
+//
+// A LOCKED token (deposits escrowed, but not yet settled) can be disputed by
+// either of its two parties within a fixed window of its creation. Evidence
+// accumulates under the dispute record until an arbitrator resolves it with a
+// verdict, at which point the offending party's deposit moves to the
+// counterparty, the honest party's own deposit is refunded, and the offender
+// takes a reputation slash that grows with the size of the disputed trade
+// relative to their trading history (so a serial bad actor with a small track
+// record is hit harder, proportionally, than a large-volume trader's one bad
+// trade).
+// ---------------------------------------------------------------------------
+
+const disputePrefix = "DISPUTE_"
+const disputeWindowSeconds = 7 * 24 * 3600 // LOCKED tokens may only be disputed within 7 days of creation
+const verdictBuyerFault = "BUYER_FAULT"
+const verdictSellerFault = "SELLER_FAULT"
+const verdictMutual = "MUTUAL"
+const disputeStateRaised = "RAISED"
+const disputeStateResolved = "RESOLVED"
+const baseSlashPenalty = 1000 // minimum reputation points slashed from an at-fault party (10.00 points)
+const maxSlashPenalty = 5000  // ceiling on the slash, regardless of trade size (50.00 points)
+
+// Dispute is the immutable-once-resolved record of a disputed token: evidence
+// hashes accumulate while RAISED, and the record is only ever appended to or
+// finalized, never rewritten.
+type Dispute struct {
+        TokenID           string   `json:"tokenID"`
+        RaisedBy          string   `json:"raisedBy"` // participant ID (buyer or seller) who opened the dispute
+        EvidenceHashes    []string `json:"evidenceHashes"`
+        State             string   `json:"state"` // "RAISED" or "RESOLVED"
+        Verdict           string   `json:"verdict"`
+        RaisedTimestamp   int64    `json:"raisedTimestamp"`
+        ResolvedTimestamp int64    `json:"resolvedTimestamp"`
+}
+
+func disputeKey(tokenID string) string { return disputePrefix + tokenID }
+
+// disputeSlashPenalty scales a reputation penalty with the disputed trade's
+// totalValue relative to the offender's historical traded volume: an offender
+// with little trading history to vouch for them is slashed closer to the
+// maximum, while an established trader's single dispute costs relatively less.
+func disputeSlashPenalty(totalValue int, offenderVolume int) int {
+        ratio := (totalValue * 100) / (offenderVolume + totalValue + 1)
+        penalty := baseSlashPenalty + ratio*(maxSlashPenalty-baseSlashPenalty)/100
+        if penalty > maxSlashPenalty {
+                penalty = maxSlashPenalty
+        }
+        if penalty < baseSlashPenalty {
+                penalty = baseSlashPenalty
+        }
+        return penalty
+}
+
+// verifyEvidenceSignature checks signatureHex against participantID's stored
+// ECDSA public key over sha256(tokenID || evidenceHash), using the same
+// PEM/PKIX/ASN.1 pipeline IssueToken uses for order signatures.
+func verifyEvidenceSignature(ctx contractapi.TransactionContextInterface, participantID string, tokenID string, evidenceHash string, signatureHex string) (bool, error) {
+        partBytes, err := ctx.GetStub().GetState(participantKey(participantID))
+        if err != nil {
+                return false, fmt.Errorf("failed to read participant: %v", err)
+        }
+        if partBytes == nil {
+                return false, fmt.Errorf("participant %s not found", participantID)
+        }
+        var participant Participant
+        if err := json.Unmarshal(partBytes, &participant); err != nil {
+                return false, fmt.Errorf("failed to unmarshal participant: %v", err)
+        }
+        block, _ := pem.Decode([]byte(participant.PublicKey))
+        if block == nil {
+                return false, fmt.Errorf("failed to decode public key for participant %s", participantID)
+        }
+        pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+                return false, fmt.Errorf("failed to parse public key: %v", err)
+        }
+        pubKey, ok := pubInterface.(*ecdsa.PublicKey)
+        if !ok {
+                return false, fmt.Errorf("public key is not ECDSA")
+        }
+        sigBytes, err := hex.DecodeString(signatureHex)
+        if err != nil {
+                return false, fmt.Errorf("invalid signature format: %v", err)
+        }
+        var sigStruct struct{ R, S *big.Int }
+        if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
+                return false, fmt.Errorf("failed to parse signature: %v", err)
+        }
+        hash := sha256.Sum256([]byte(tokenID + evidenceHash))
+        return ecdsa.Verify(pubKey, hash[:], sigStruct.R, sigStruct.S), nil
+}
+
+// RaiseDispute opens a dispute over a LOCKED token still within its dispute
+// window. The caller must produce a valid ECDSA signature, over the token ID
+// and evidence hash, from either the buyer's or the seller's registered key;
+// whichever matches becomes the dispute's RaisedBy.
+func (s *SmartContract) RaiseDispute(ctx contractapi.TransactionContextInterface, tokenID string, evidenceHash string, signatureHex string) error {
+        existing, err := ctx.GetStub().GetState(disputeKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to check dispute existence: %v", err)
+        }
+        if existing != nil {
+                return fmt.Errorf("dispute for token %s already exists", tokenID)
+        }
+
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read token: %v", err)
+        }
+        if tokenBytes == nil {
+                return fmt.Errorf("transaction token %s not found", tokenID)
+        }
+        var token EnergyToken
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
+        if token.State != "LOCKED" {
+                return fmt.Errorf("token %s is not in a LOCKED state for dispute (current state: %s)", tokenID, token.State)
+        }
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        if txTime.GetSeconds()-token.Timestamp > disputeWindowSeconds {
+                return fmt.Errorf("token %s is outside the %d-second dispute window", tokenID, disputeWindowSeconds)
+        }
+
+        var raisedBy string
+        if validBuyer, err := verifyEvidenceSignature(ctx, token.BuyerID, tokenID, evidenceHash, signatureHex); err != nil {
+                return err
+        } else if validBuyer {
+                raisedBy = token.BuyerID
+        } else if validSeller, err := verifyEvidenceSignature(ctx, token.SellerID, tokenID, evidenceHash, signatureHex); err != nil {
+                return err
+        } else if validSeller {
+                raisedBy = token.SellerID
+        } else {
+                return fmt.Errorf("signature does not match the buyer or seller of token %s", tokenID)
+        }
+
+        dispute := Dispute{
+                TokenID:         tokenID,
+                RaisedBy:        raisedBy,
+                EvidenceHashes:  []string{evidenceHash},
+                State:           disputeStateRaised,
+                RaisedTimestamp: txTime.GetSeconds(),
+        }
+        disputeBytes, err := json.Marshal(dispute)
+        if err != nil {
+                return fmt.Errorf("failed to marshal dispute: %v", err)
+        }
+        return ctx.GetStub().PutState(disputeKey(tokenID), disputeBytes)
+}
+
+// SubmitEvidence appends another signed evidence hash to a still-open dispute.
+// The signer must again be the token's buyer or seller.
+func (s *SmartContract) SubmitEvidence(ctx contractapi.TransactionContextInterface, tokenID string, evidenceHash string, signatureHex string) error {
+        disputeBytes, err := ctx.GetStub().GetState(disputeKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read dispute: %v", err)
+        }
+        if disputeBytes == nil {
+                return fmt.Errorf("no dispute exists for token %s", tokenID)
+        }
+        var dispute Dispute
+        if err := json.Unmarshal(disputeBytes, &dispute); err != nil {
+                return fmt.Errorf("failed to unmarshal dispute: %v", err)
+        }
+        if dispute.State != disputeStateRaised {
+                return fmt.Errorf("dispute for token %s is already %s", tokenID, dispute.State)
+        }
+
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil || tokenBytes == nil {
+                return fmt.Errorf("token %s not found", tokenID)
+        }
+        var token EnergyToken
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
+
+        validBuyer, err := verifyEvidenceSignature(ctx, token.BuyerID, tokenID, evidenceHash, signatureHex)
+        if err != nil {
+                return err
+        }
+        if !validBuyer {
+                validSeller, err := verifyEvidenceSignature(ctx, token.SellerID, tokenID, evidenceHash, signatureHex)
+                if err != nil {
+                        return err
+                }
+                if !validSeller {
+                        return fmt.Errorf("signature does not match the buyer or seller of token %s", tokenID)
+                }
+        }
+
+        dispute.EvidenceHashes = append(dispute.EvidenceHashes, evidenceHash)
+        updatedBytes, err := json.Marshal(dispute)
+        if err != nil {
+                return fmt.Errorf("failed to marshal dispute: %v", err)
+        }
+        return ctx.GetStub().PutState(disputeKey(tokenID), updatedBytes)
+}
+
+// ResolveDispute finalizes a RAISED dispute with a verdict of BUYER_FAULT,
+// SELLER_FAULT, or MUTUAL, restricted to the admin MSP that also governs
+// market halts. BUYER_FAULT/SELLER_FAULT move the offender's deposit to the
+// counterparty, refund the honest party's own deposit, and slash the
+// offender's reputation. MUTUAL refunds both deposits to their own owners and
+// slashes both parties by half the single-party penalty.
+func (s *SmartContract) ResolveDispute(ctx contractapi.TransactionContextInterface, tokenID string, verdict string) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may resolve disputes")
+        }
+        if verdict != verdictBuyerFault && verdict != verdictSellerFault && verdict != verdictMutual {
+                return fmt.Errorf("verdict must be BUYER_FAULT, SELLER_FAULT, or MUTUAL")
+        }
+
+        disputeBytes, err := ctx.GetStub().GetState(disputeKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read dispute: %v", err)
+        }
+        if disputeBytes == nil {
+                return fmt.Errorf("no dispute exists for token %s", tokenID)
+        }
+        var dispute Dispute
+        if err := json.Unmarshal(disputeBytes, &dispute); err != nil {
+                return fmt.Errorf("failed to unmarshal dispute: %v", err)
+        }
+        if dispute.State != disputeStateRaised {
+                return fmt.Errorf("dispute for token %s is already %s", tokenID, dispute.State)
+        }
+
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil || tokenBytes == nil {
+                return fmt.Errorf("token %s not found", tokenID)
+        }
+        var token EnergyToken
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
+        if token.State != "LOCKED" {
+                return fmt.Errorf("token %s is no longer LOCKED (state: %s)", tokenID, token.State)
+        }
+
+        buyerPtr, err := loadParticipant(ctx, token.BuyerID)
+        if err != nil {
+                return err
+        }
+        buyer := *buyerPtr
+        sellerPtr, err := loadParticipant(ctx, token.SellerID)
+        if err != nil {
+                return err
+        }
+        seller := *sellerPtr
+
+        totalValue := token.EnergyAmount * token.Price
+
+        switch verdict {
+        case verdictBuyerFault:
+                seller.Balance += token.BuyerDeposit
+                seller.Balance += token.SellerDeposit
+                penalty := disputeSlashPenalty(totalValue, buyer.TotalTradedVolume)
+                buyer.Reputation -= penalty
+                if buyer.Reputation < 0 {
+                        buyer.Reputation = 0
+                }
+        case verdictSellerFault:
+                buyer.Balance += token.SellerDeposit
+                buyer.Balance += token.BuyerDeposit
+                penalty := disputeSlashPenalty(totalValue, seller.TotalTradedVolume)
+                seller.Reputation -= penalty
+                if seller.Reputation < 0 {
+                        seller.Reputation = 0
+                }
+        case verdictMutual:
+                buyer.Balance += token.BuyerDeposit
+                seller.Balance += token.SellerDeposit
+                buyerPenalty := disputeSlashPenalty(totalValue, buyer.TotalTradedVolume) / 2
+                sellerPenalty := disputeSlashPenalty(totalValue, seller.TotalTradedVolume) / 2
+                buyer.Reputation -= buyerPenalty
+                if buyer.Reputation < 0 {
+                        buyer.Reputation = 0
+                }
+                seller.Reputation -= sellerPenalty
+                if seller.Reputation < 0 {
+                        seller.Reputation = 0
+                }
+        }
+
+        token.BuyerDeposit = 0
+        token.SellerDeposit = 0
+        token.State = "DEFAULT"
+
+        buyerBytes, err := json.Marshal(buyer)
+        if err != nil {
+                return fmt.Errorf("failed to marshal buyer: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(buyer.ID), buyerBytes); err != nil {
+                return err
+        }
+        sellerBytes, err := json.Marshal(seller)
+        if err != nil {
+                return fmt.Errorf("failed to marshal seller: %v", err)
+        }
+        if err := ctx.GetStub().PutState(participantKey(seller.ID), sellerBytes); err != nil {
+                return err
+        }
+        tokenBytes, err = json.Marshal(token)
+        if err != nil {
+                return fmt.Errorf("failed to marshal token: %v", err)
+        }
+        if err := ctx.GetStub().PutState(tokenKey(token.TokenID), tokenBytes); err != nil {
+                return err
+        }
+
+        txTime, err := ctx.GetStub().GetTxTimestamp()
+        if err != nil {
+                return fmt.Errorf("failed to get transaction timestamp: %v", err)
+        }
+        dispute.State = disputeStateResolved
+        dispute.Verdict = verdict
+        dispute.ResolvedTimestamp = txTime.GetSeconds()
+        resolvedBytes, err := json.Marshal(dispute)
+        if err != nil {
+                return fmt.Errorf("failed to marshal dispute: %v", err)
+        }
+        return ctx.GetStub().PutState(disputeKey(tokenID), resolvedBytes)
+}
+
+// GetDispute returns the Dispute record for a given token ID
+func (s *SmartContract) GetDispute(ctx contractapi.TransactionContextInterface, tokenID string) (*Dispute, error) {
+        data, err := ctx.GetStub().GetState(disputeKey(tokenID))
+        if err != nil {
+                return nil, fmt.Errorf("failed to read dispute: %v", err)
+        }
+        if data == nil {
+                return nil, fmt.Errorf("no dispute exists for token %s", tokenID)
+        }
+        var dispute Dispute
+        _ = json.Unmarshal(data, &dispute)
+        return &dispute, nil
+}
+
+// ---------------------------------------------------------------------------
+// Multi-endorser notary settlement
+//
+// High-value tokens should not settle on a single SettleTransaction call.
+// The admin MSP configures a notary set (AddNotary/RemoveNotary) and an
+// M-of-N threshold (SetNotaryThreshold); any token whose EnergyAmount*Price
+// meets or exceeds SetNotaryValueThreshold is then only settleable through
+// NotarySettleTransaction, which requires that many distinct valid notary
+// signatures over the token's settlement claim before it delegates to the
+// same settleLockedToken logic SettleTransaction uses.
+
+const notarySetKey = "NOTARYSET"
+
+// NotaryConfig is the single piece of state backing the notary set: its
+// members (by notary ID, not necessarily a registered Participant), the
+// M-of-N threshold required to settle a gated token, and the value at/above
+// which a token is gated at all.
+type NotaryConfig struct {
+        Notaries       map[string]string `json:"notaries"`       // notaryID -> PEM-encoded ECDSA public key
+        Threshold      int               `json:"threshold"`      // M of N distinct notary signatures required
+        ValueThreshold int               `json:"valueThreshold"` // EnergyAmount*Price at/above which notary settlement is mandatory (0 = disabled)
+}
+
+// NotarySignature is one notary's signature over a NotarySettleTransaction claim.
+type NotarySignature struct {
+        ParticipantID string `json:"participantID"` // notary ID, key into NotaryConfig.Notaries
+        SignatureHex  string `json:"signatureHex"`
+}
+
+func loadNotaryConfig(ctx contractapi.TransactionContextInterface) (*NotaryConfig, error) {
+        cfgBytes, err := ctx.GetStub().GetState(notarySetKey)
+        if err != nil {
+                return nil, fmt.Errorf("failed to read notary set: %v", err)
+        }
+        cfg := &NotaryConfig{Notaries: make(map[string]string)}
+        if cfgBytes != nil {
+                if err := json.Unmarshal(cfgBytes, cfg); err != nil {
+                        return nil, fmt.Errorf("failed to unmarshal notary set: %v", err)
+                }
+                if cfg.Notaries == nil {
+                        cfg.Notaries = make(map[string]string)
+                }
+        }
+        return cfg, nil
+}
+
+func saveNotaryConfig(ctx contractapi.TransactionContextInterface, cfg *NotaryConfig) error {
+        cfgBytes, err := json.Marshal(cfg)
+        if err != nil {
+                return fmt.Errorf("failed to marshal notary set: %v", err)
+        }
+        return ctx.GetStub().PutState(notarySetKey, cfgBytes)
+}
+
+// AddNotary registers (or replaces the key of) a notary in the notary set.
+// Restricted to the admin identity.
+func (s *SmartContract) AddNotary(ctx contractapi.TransactionContextInterface, notaryID string, publicKeyPem string) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may manage the notary set")
+        }
+        if _, err := parseECDSAPublicKeyPEM(publicKeyPem); err != nil {
+                return fmt.Errorf("invalid notary public key: %v", err)
+        }
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
+        }
+        cfg.Notaries[notaryID] = publicKeyPem
+        return saveNotaryConfig(ctx, cfg)
+}
+
+// RemoveNotary drops a notary from the notary set. Restricted to the admin identity.
+func (s *SmartContract) RemoveNotary(ctx contractapi.TransactionContextInterface, notaryID string) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may manage the notary set")
+        }
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
+        }
+        delete(cfg.Notaries, notaryID)
+        return saveNotaryConfig(ctx, cfg)
+}
+
+// SetNotaryThreshold configures the M-of-N signature count NotarySettleTransaction
+// requires. Restricted to the admin identity.
+func (s *SmartContract) SetNotaryThreshold(ctx contractapi.TransactionContextInterface, threshold int) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may manage the notary set")
+        }
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
+        }
+        if threshold <= 0 || threshold > len(cfg.Notaries) {
+                return fmt.Errorf("threshold must be between 1 and the number of registered notaries (%d)", len(cfg.Notaries))
+        }
+        cfg.Threshold = threshold
+        return saveNotaryConfig(ctx, cfg)
+}
+
+// SetNotaryValueThreshold configures the EnergyAmount*Price value at/above which
+// SettleTransaction rejects a token and NotarySettleTransaction becomes mandatory.
+// A threshold of 0 disables mandatory notary settlement. Restricted to the admin identity.
+func (s *SmartContract) SetNotaryValueThreshold(ctx contractapi.TransactionContextInterface, valueThreshold int) error {
+        admin, err := isAdmin(ctx)
+        if err != nil {
+                return err
+        }
+        if !admin {
+                return fmt.Errorf("only the admin identity may manage the notary set")
+        }
+        if valueThreshold < 0 {
+                return fmt.Errorf("value threshold must not be negative")
+        }
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
+        }
+        cfg.ValueThreshold = valueThreshold
+        return saveNotaryConfig(ctx, cfg)
+}
+
+// meterReadingHash derives the delivery-evidence hash notaries sign over from
+// a token's accumulated, seller-signed MeterReadings (see ProcessEnergyFlow):
+// the hex-encoded sha256 of their JSON encoding, or "" if no reading has been
+// recorded yet.
+func meterReadingHash(token EnergyToken) (string, error) {
+        if len(token.MeterReadings) == 0 {
+                return "", nil
+        }
+        readingsJSON, err := json.Marshal(token.MeterReadings)
+        if err != nil {
+                return "", fmt.Errorf("failed to marshal meter readings: %v", err)
+        }
+        hash := sha256.Sum256(readingsJSON)
+        return hex.EncodeToString(hash[:]), nil
+}
+
+// NotarySettleTransaction settles a LOCKED token that requires notary oversight
+// (see SetNotaryValueThreshold). signaturesJSON is a JSON array of
+// NotarySignature, each a notary's signature over the sha256 of the string
+// "tokenID|sellerDelivered|buyerPaid|meterReadingHash" (the two flags written
+// as true or false), where meterReadingHash is
+// the hash of the token's accumulated MeterReadings (see meterReadingHash),
+// binding the notaries' attestation to the actual delivery evidence rather
+// than just the derived booleans. Once at least Threshold distinct registered
+// notaries have produced a valid signature, it delegates to the same
+// settlement logic SettleTransaction uses below the notary threshold.
+func (s *SmartContract) NotarySettleTransaction(ctx contractapi.TransactionContextInterface, tokenID string, signaturesJSON string) error {
+        tokenBytes, err := ctx.GetStub().GetState(tokenKey(tokenID))
+        if err != nil {
+                return fmt.Errorf("failed to read token: %v", err)
+        }
+        if tokenBytes == nil {
+                return fmt.Errorf("transaction token %s not found", tokenID)
+        }
+        var token EnergyToken
+        if err := json.Unmarshal(tokenBytes, &token); err != nil {
+                return fmt.Errorf("failed to unmarshal token: %v", err)
+        }
+        if token.State != "LOCKED" {
+                return fmt.Errorf("transaction %s is already settled (state: %s)", tokenID, token.State)
+        }
+
+        cfg, err := loadNotaryConfig(ctx)
+        if err != nil {
+                return err
+        }
+        if cfg.Threshold <= 0 || len(cfg.Notaries) == 0 {
+                return fmt.Errorf("no notary set is configured")
+        }
+
+        readingHash, err := meterReadingHash(token)
+        if err != nil {
+                return err
+        }
+        message := fmt.Sprintf("%s|%t|%t|%s", token.TokenID, token.SellerDelivered, token.BuyerPaid, readingHash)
+        msgHash := sha256.Sum256([]byte(message))
+
+        var sigs []NotarySignature
+        if err := json.Unmarshal([]byte(signaturesJSON), &sigs); err != nil {
+                return fmt.Errorf("failed to unmarshal notary signatures: %v", err)
+        }
+
+        seen := make(map[string]bool)
+        for _, sig := range sigs {
+                if seen[sig.ParticipantID] {
+                        continue
+                }
+                keyPem, ok := cfg.Notaries[sig.ParticipantID]
+                if !ok {
+                        continue
+                }
+                pubKey, err := parseECDSAPublicKeyPEM(keyPem)
+                if err != nil {
+                        continue
+                }
+                sigBytes, err := hex.DecodeString(sig.SignatureHex)
+                if err != nil {
+                        continue
+                }
+                var sigStruct struct{ R, S *big.Int }
+                if _, err := asn1.Unmarshal(sigBytes, &sigStruct); err != nil {
+                        continue
+                }
+                if !ecdsa.Verify(pubKey, msgHash[:], sigStruct.R, sigStruct.S) {
+                        continue
+                }
+                seen[sig.ParticipantID] = true
+        }
+        if len(seen) < cfg.Threshold {
+                return fmt.Errorf("only %d of required %d distinct valid notary signatures for token %s", len(seen), cfg.Threshold, tokenID)
+        }
+
+        return settleLockedToken(ctx, tokenID)
+}
+
 func main() {
         chaincode, err := contractapi.NewChaincode(new(SmartContract))
         if err != nil {
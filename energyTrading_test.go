@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// newTestContext wires up a fresh in-memory MockStub behind a
+// contractapi.TransactionContext, the standard way to unit test
+// fabric-contract-api-go chaincode without a real peer. The stub is driven
+// directly (GetState/PutState/GetStateByRange) rather than through
+// Init/Invoke dispatch, so it doesn't need a registered chaincode; nil
+// satisfies shimtest.NewMockStub's shim.Chaincode parameter since that value
+// is only consulted by MockStub's Init/Invoke wrappers.
+func newTestContext(t *testing.T) *contractapi.TransactionContext {
+	t.Helper()
+	stub := shimtest.NewMockStub("reputrade", nil)
+	stub.MockTransactionStart("tx1")
+	t.Cleanup(func() { stub.MockTransactionEnd("tx1") })
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	return ctx
+}
+
+func putParticipant(t *testing.T, ctx contractapi.TransactionContextInterface, id string, reputation int) {
+	t.Helper()
+	p := Participant{ID: id, Reputation: reputation, ReputationMigrated: true, Balance: 1000}
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("marshal participant: %v", err)
+	}
+	if err := ctx.GetStub().PutState(participantKey(id), raw); err != nil {
+		t.Fatalf("put participant: %v", err)
+	}
+}
+
+// putRestingOrder writes an order and its book entry directly, mirroring what
+// CreateOrder would persist, without needing a signed public key.
+func putRestingOrder(t *testing.T, ctx contractapi.TransactionContextInterface, order Order) {
+	t.Helper()
+	orderCopy := order
+	if err := putBookEntry(ctx, &orderCopy); err != nil {
+		t.Fatalf("put book entry: %v", err)
+	}
+	raw, err := json.Marshal(orderCopy)
+	if err != nil {
+		t.Fatalf("marshal order: %v", err)
+	}
+	if err := ctx.GetStub().PutState(orderKey(orderCopy.OrderID), raw); err != nil {
+		t.Fatalf("put order: %v", err)
+	}
+}
+
+// TestBestOrderReputationTieBreak verifies that among multiple orders resting
+// at the same best price level, bestOrder picks the one belonging to the
+// highest-reputation participant rather than simply the first to arrive.
+func TestBestOrderReputationTieBreak(t *testing.T) {
+	ctx := newTestContext(t)
+
+	putParticipant(t, ctx, "low-rep-seller", 3000)
+	putParticipant(t, ctx, "high-rep-seller", 9000)
+
+	// low-rep-seller arrives first (lower book sequence number), but
+	// high-rep-seller should still win the tie-break on reputation.
+	putRestingOrder(t, ctx, Order{OrderID: "sell-low", ParticipantID: "low-rep-seller", OrderType: sideSell, EnergyAmount: 10, Price: 100})
+	putRestingOrder(t, ctx, Order{OrderID: "sell-high", ParticipantID: "high-rep-seller", OrderType: sideSell, EnergyAmount: 10, Price: 100})
+
+	best, err := bestOrder(ctx, sideSell, nil)
+	if err != nil {
+		t.Fatalf("bestOrder returned error: %v", err)
+	}
+	if best == nil {
+		t.Fatal("bestOrder returned nil, expected a match")
+	}
+	if best.OrderID != "sell-high" {
+		t.Fatalf("expected highest-reputation order sell-high to win the tie-break, got %s", best.OrderID)
+	}
+}
+
+// TestBestOrderSkipsExcluded verifies that bestOrder skips orders present in
+// the excluded set and falls through to the next-best candidate at the same
+// price level — the mechanism PerformMarketMatching relies on to route around
+// a pairing rejected for an unmet reputation floor instead of stalling.
+func TestBestOrderSkipsExcluded(t *testing.T) {
+	ctx := newTestContext(t)
+
+	putParticipant(t, ctx, "low-rep-seller", 3000)
+	putParticipant(t, ctx, "high-rep-seller", 9000)
+
+	putRestingOrder(t, ctx, Order{OrderID: "sell-low", ParticipantID: "low-rep-seller", OrderType: sideSell, EnergyAmount: 10, Price: 100})
+	putRestingOrder(t, ctx, Order{OrderID: "sell-high", ParticipantID: "high-rep-seller", OrderType: sideSell, EnergyAmount: 10, Price: 100})
+
+	best, err := bestOrder(ctx, sideSell, map[string]bool{"sell-high": true})
+	if err != nil {
+		t.Fatalf("bestOrder returned error: %v", err)
+	}
+	if best == nil {
+		t.Fatal("bestOrder returned nil, expected a match")
+	}
+	if best.OrderID != "sell-low" {
+		t.Fatalf("expected excluded sell-high to be skipped in favor of sell-low, got %s", best.OrderID)
+	}
+}